@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/bueti/go-worktree/worktree"
+)
+
+// command runs a subcommand with the arguments following its name. The
+// global flags are already parsed into config.
+type command func(ctx context.Context, config *worktree.Config, args []string) error
+
+// errUsage is returned by a command called with the wrong arguments, main
+// prints the usage for it.
+var errUsage = errors.New("invalid arguments")
+
+// commands maps the subcommand names to their commands. Any other first
+// argument is the branch to create a worktree for.
+var commands = map[string]command{
+	"list":       runList,
+	"files":      runFiles,
+	"open":       runOpen,
+	"remove":     runRemove,
+	"move":       runMove,
+	"prune":      runPrune,
+	"config":     runConfig,
+	"completion": runCompletion,
+	"__branches": runBranches,
+}
+
+// dispatch runs the subcommand named by args[0], or the external command
+// worktree-<args[0]>, or creates a worktree for the branch args[0] if there is
+// neither.
+func dispatch(ctx context.Context, config *worktree.Config, args []string) error {
+	if run, ok := commands[args[0]]; ok {
+		return run(ctx, config, args[1:])
+	}
+	if path := externalCommand(ctx, *config, args[0]); path != "" {
+		return runExternal(ctx, path, args[1:])
+	}
+	return runCreate(ctx, config, args)
+}
+
+// newFlagSet returns the flag set of a subcommand, which prints the usage on
+// invalid flags like the global one.
+func newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.Usage = usage
+	return flags
+}
+
+// parseArgs parses the flags of a subcommand and returns its positional
+// arguments, or errUsage if there are fewer than minArgs or more than maxArgs.
+func parseArgs(flags *flag.FlagSet, args []string, minArgs, maxArgs int) ([]string, error) {
+	flags.Parse(args)
+	if flags.NArg() < minArgs || flags.NArg() > maxArgs {
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+func runCreate(ctx context.Context, config *worktree.Config, args []string) error {
+	branch := args[0]
+	if worktree.IsURL(branch) {
+		var err error
+		if branch, err = branchFromURL(*config, branch); err != nil {
+			return err
+		}
+	}
+	_, err := worktree.NewWorktreeManager(*config).CreateWorktree(ctx, branch)
+	return err
+}
+
+func runList(ctx context.Context, config *worktree.Config, args []string) error {
+	flags := newFlagSet("list")
+	flags.BoolVar(&config.Verbose, "v", config.Verbose, "show upstream branch and working tree status")
+	flags.BoolVar(&config.Verbose, "verbose", config.Verbose, "show upstream branch and working tree status")
+	if _, err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+	return worktree.NewWorktreeManager(*config).ListWorktrees(ctx)
+}
+
+func runFiles(ctx context.Context, config *worktree.Config, args []string) error {
+	args, err := parseArgs(newFlagSet("files"), args, 0, 1)
+	if err != nil {
+		return err
+	}
+	var branch string
+	if len(args) == 1 {
+		branch = args[0]
+	}
+	return worktree.NewWorktreeManager(*config).ListFiles(ctx, branch)
+}
+
+func runOpen(ctx context.Context, config *worktree.Config, args []string) error {
+	args, err := parseArgs(newFlagSet("open"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	_, err = worktree.NewWorktreeManager(*config).OpenWorktree(ctx, args[0])
+	return err
+}
+
+func runRemove(ctx context.Context, config *worktree.Config, args []string) error {
+	flags := newFlagSet("remove")
+	flags.BoolVar(&config.Force, "f", false, "remove even if the worktree has changes")
+	flags.BoolVar(&config.DeleteBranch, "d", false, "also delete the local branch")
+	args, err := parseArgs(flags, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return worktree.NewWorktreeManager(*config).RemoveWorktree(ctx, args[0])
+}
+
+func runMove(ctx context.Context, config *worktree.Config, args []string) error {
+	args, err := parseArgs(newFlagSet("move"), args, 2, 2)
+	if err != nil {
+		return err
+	}
+	return worktree.NewWorktreeManager(*config).MoveWorktree(ctx, args[0], args[1])
+}
+
+func runPrune(ctx context.Context, config *worktree.Config, args []string) error {
+	flags := newFlagSet("prune")
+	flags.BoolVar(&config.Gone, "gone", false, "offer to remove worktrees whose upstream branch is gone")
+	if _, err := parseArgs(flags, args, 0, 0); err != nil {
+		return err
+	}
+	return worktree.NewWorktreeManager(*config).PruneWorktrees(ctx)
+}
+
+func runConfig(ctx context.Context, config *worktree.Config, args []string) error {
+	if _, err := parseArgs(newFlagSet("config"), args, 0, 0); err != nil {
+		return err
+	}
+	return worktree.NewWorktreeManager(*config).ShowConfig()
+}
+
+func runCompletion(ctx context.Context, config *worktree.Config, args []string) error {
+	args, err := parseArgs(newFlagSet("completion"), args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return printCompletion(args[0])
+}
+
+func runBranches(ctx context.Context, config *worktree.Config, args []string) error {
+	return printBranches(ctx, *config)
+}
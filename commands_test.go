@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bueti/go-worktree/worktree"
+)
+
+// newDispatchRepo returns a repository with a commit on main and the given
+// branches, and changes into it.
+func newDispatchRepo(t *testing.T, branches ...string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(home, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("XDG_CONFIG_HOME", home)
+
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v: %s", strings.Join(args, " "), err, output)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("commit", "-q", "--allow-empty", "-m", "initial")
+	for _, branch := range branches {
+		git("branch", branch)
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+func TestDispatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the external command is a shell script")
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		branches []string
+		// want is the subcommand, "external" or "create"
+		want     string
+		wantArgs []string
+	}{
+		{name: "subcommand", args: []string{"list"}, want: "list"},
+		{name: "subcommand with arguments", args: []string{"remove", "-d", "feature"}, want: "remove", wantArgs: []string{"-d", "feature"}},
+		{name: "subcommand over branch", args: []string{"list"}, branches: []string{"list"}, want: "list"},
+		{name: "new branch", args: []string{"feature"}, want: "create"},
+		{name: "existing branch", args: []string{"feature"}, branches: []string{"feature"}, want: "create"},
+		{name: "external command", args: []string{"hello", "world"}, want: "external", wantArgs: []string{"world"}},
+		{name: "branch over external command", args: []string{"hello"}, branches: []string{"hello"}, want: "create"},
+		{name: "branch with a slash", args: []string{"hello/world"}, want: "create"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := newDispatchRepo(t, tt.branches...)
+
+			// worktree-hello records its arguments
+			bin := t.TempDir()
+			record := filepath.Join(bin, "args")
+			script := "#!/bin/sh\necho \"$@\" > " + record + "\n"
+			if err := os.WriteFile(filepath.Join(bin, "worktree-hello"), []byte(script), 0755); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+			var got string
+			var gotArgs []string
+			for _, name := range []string{"list", "remove"} {
+				saved := commands[name]
+				commands[name] = func(ctx context.Context, config *worktree.Config, args []string) error {
+					got, gotArgs = name, args
+					return nil
+				}
+				t.Cleanup(func() { commands[name] = saved })
+			}
+
+			config := &worktree.Config{NoCopy: true, NoChdir: true, NoPull: true, Quiet: true, Logger: log.New(io.Discard, "", 0)}
+			if err := dispatch(context.Background(), config, tt.args); err != nil {
+				t.Fatalf("dispatch(%q) = %v", tt.args, err)
+			}
+
+			if recorded, err := os.ReadFile(record); err == nil {
+				got = "external"
+				gotArgs = strings.Fields(string(recorded))
+			}
+			worktreePath := filepath.Join(filepath.Dir(dir), strings.ReplaceAll(tt.args[0], "/", "_"))
+			if _, err := os.Stat(worktreePath); err == nil {
+				if got != "" {
+					t.Fatalf("dispatch(%q) ran %s and created a worktree", tt.args, got)
+				}
+				got = "create"
+			}
+			if got != tt.want || !slices.Equal(gotArgs, tt.wantArgs) {
+				t.Errorf("dispatch(%q) ran %s %q, want %s %q", tt.args, got, gotArgs, tt.want, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestDispatchFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		// verbose is the global -v, parsed before the subcommand
+		verbose bool
+		args    []string
+		want    bool
+	}{
+		{name: "global flag", verbose: true, args: []string{"list"}, want: true},
+		{name: "subcommand flag", args: []string{"list", "-v"}, want: true},
+		{name: "subcommand flag overrides global flag", verbose: true, args: []string{"list", "-v=false"}, want: false},
+		{name: "neither", args: []string{"list"}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newDispatchRepo(t)
+			config := &worktree.Config{Verbose: tt.verbose, Quiet: true, Logger: log.New(io.Discard, "", 0)}
+			if err := dispatch(context.Background(), config, tt.args); err != nil {
+				t.Fatalf("dispatch(%q) = %v", tt.args, err)
+			}
+			if config.Verbose != tt.want {
+				t.Errorf("dispatch(%q) verbose = %v, want %v", tt.args, config.Verbose, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/bueti/go-worktree/worktree"
+)
+
+var ErrUnknownShell = errors.New("unknown shell, expected bash, zsh, or fish")
+
+var subcommands = []string{"list", "files", "open", "remove", "move", "prune", "config", "completion"}
+
+func printCompletion(shell string) error {
+	var flags []string
+	flag.VisitAll(func(f *flag.Flag) {
+		flags = append(flags, "-"+f.Name)
+	})
+
+	names := strings.Join(subcommands, " ")
+	switch shell {
+	case "bash":
+		fmt.Printf(bashCompletion, strings.Join(flags, " "), names)
+	case "zsh":
+		fmt.Printf(zshCompletion, strings.Join(flags, " "), names)
+	case "fish":
+		fmt.Print(fishCompletion(names))
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownShell, shell)
+	}
+	return nil
+}
+
+// printBranches prints the branch names offered by the completion scripts.
+func printBranches(ctx context.Context, config worktree.Config) error {
+	branches, err := worktree.NewWorktreeManager(config).Branches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, branch := range branches {
+		fmt.Println(branch)
+	}
+	return nil
+}
+
+const bashCompletion = `_worktree() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+    case "$prev" in
+        -from|files|open|remove|move)
+            COMPREPLY=($(compgen -W "$(worktree __branches 2>/dev/null)" -- "$cur"))
+            return
+            ;;
+        completion)
+            COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur"))
+            return
+            ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "%s" -- "$cur"))
+        return
+    fi
+
+    COMPREPLY=($(compgen -W "%s $(worktree __branches 2>/dev/null)" -- "$cur"))
+}
+complete -F _worktree worktree
+`
+
+const zshCompletion = `#compdef worktree
+
+_worktree() {
+    local -a branches flags commands
+    branches=(${(f)"$(worktree __branches 2>/dev/null)"})
+    flags=(%s)
+    commands=(%s)
+
+    case "${words[CURRENT-1]}" in
+        -from|files|open|remove|move)
+            compadd -a branches
+            return
+            ;;
+        completion)
+            compadd bash zsh fish
+            return
+            ;;
+    esac
+
+    if [[ "$PREFIX" == -* ]]; then
+        compadd -a flags
+        return
+    fi
+
+    compadd -a commands
+    compadd -a branches
+}
+
+compdef _worktree worktree
+`
+
+func fishCompletion(commands string) string {
+	var b strings.Builder
+	b.WriteString("complete -c worktree -f\n")
+	fmt.Fprintf(&b, "complete -c worktree -n '__fish_use_subcommand' -a '%s'\n", commands)
+	b.WriteString("complete -c worktree -n 'not __fish_seen_subcommand_from list prune config completion' -a '(worktree __branches 2>/dev/null)'\n")
+	b.WriteString("complete -c worktree -n '__fish_seen_subcommand_from completion' -a 'bash zsh fish'\n")
+	flag.VisitAll(func(f *flag.Flag) {
+		fmt.Fprintf(&b, "complete -c worktree -o %s -d '%s'", f.Name, strings.ReplaceAll(f.Usage, "'", `\'`))
+		if f.Name == "from" {
+			b.WriteString(" -r -a '(worktree __branches 2>/dev/null)'")
+		}
+		b.WriteString("\n")
+	})
+	return b.String()
+}
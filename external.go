@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/bueti/go-worktree/worktree"
+)
+
+// externalPrefix is the prefix of the executables that add subcommands, like
+// git runs git-<name> for git <name>.
+const externalPrefix = "worktree-"
+
+// externalCommand returns the path of the worktree-<name> executable on PATH
+// for a name that is not a subcommand, or "" if there is none. A branch of
+// that name takes precedence, so that installing a command doesn't change
+// what worktree <branch name> does for an existing branch.
+func externalCommand(ctx context.Context, config worktree.Config, name string) string {
+	if name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, `/\`) {
+		return ""
+	}
+	path, err := exec.LookPath(externalPrefix + name)
+	if err != nil {
+		return ""
+	}
+
+	// Looking up the branches changes to the repository root, the command
+	// runs where worktree was called from
+	if cwd, err := os.Getwd(); err == nil {
+		defer os.Chdir(cwd)
+	}
+	branches, err := worktree.NewWorktreeManager(config).Branches(ctx)
+	if err == nil && slices.Contains(branches, name) {
+		return ""
+	}
+	return path
+}
+
+// runExternal runs an external command with the arguments following its
+// name, connected to the terminal. If it fails, worktree exits with its exit
+// code, the command has reported the error itself.
+func runExternal(ctx context.Context, path string, args []string) error {
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
@@ -2,72 +2,272 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
-	"log"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 
-	"github.com/muesli/termenv"
+	"github.com/bueti/go-worktree/worktree"
 )
 
-var (
-	profile = termenv.ColorProfile()
-	red     = termenv.String("").Foreground(profile.Color("#FF005F"))
-	green   = termenv.String("").Foreground(profile.Color("#00FF00"))
-	yellow  = termenv.String("").Foreground(profile.Color("#FFFF00"))
-)
-
-var (
-	ErrNotInGitRepo           = errors.New("not in a git repository")
-	ErrWorktreeCreationFailed = errors.New("failed to create git worktree")
-)
-
-type Config struct {
-	verbose bool
-	logger  *log.Logger
-}
-
-type WorktreeManager struct {
-	repo   *GitRepo
-	config *Config
-}
-
 func main() {
-	var verbose bool
-	flag.BoolVar(&verbose, "v", false, "verbose output")
-	flag.BoolVar(&verbose, "verbose", false, "verbose output")
+	var config worktree.Config
+	flag.BoolVar(&config.Verbose, "v", false, "verbose output")
+	flag.BoolVar(&config.Verbose, "verbose", false, "verbose output")
+	flag.BoolVar(&config.Trace, "vv", false, "verbose output, and log every command that is run")
+	flag.StringVar(&config.ConfigFile, "config", "", "read settings from this file (default ~/.config/worktree/config.yaml)")
+	flag.IntVar(&config.PR, "pr", 0, "check out this pull request number from GitHub or GitLab")
+	flag.StringVar(&config.From, "from", "", "base ref for new branches")
+	flag.BoolVar(&config.FromDefault, "from-default", false, "base new branches on the fetched default branch instead of HEAD")
+	flag.BoolVar(&config.Detach, "detach", false, "check out HEAD or -from without creating a branch")
+	flag.BoolVar(&config.AsBranch, "as-branch", false, "create a branch named after a tag instead of a detached worktree at it")
+	flag.BoolVar(&config.NoCopy, "no-copy", false, "don't copy untracked files into the worktree")
+	flag.StringVar(&config.CopyFrom, "copy-from", "", "copy untracked files from this worktree, a path or branch name")
+	flag.Func("copy-patterns", "copy untracked files matching these comma-separated patterns instead of the configured ones", func(value string) error {
+		config.CopyPatterns = splitPatterns(value)
+		return nil
+	})
+	flag.BoolVar(&config.Overwrite, "overwrite-copies", false, "replace untracked files that already exist in the worktree")
+	flag.BoolVar(&config.HardlinkDeps, "hardlink-modules", false, "hardlink node_modules into the worktree instead of copying it")
+	flag.BoolVar(&config.Link, "link", false, "symlink untracked files to the repository instead of copying them")
+	flag.BoolVar(&config.CopyGitConfig, "copy-git-config", false, "copy local git config such as user.email into the worktree's own config")
+	flag.BoolVar(&config.CarryChanges, "carry-changes", false, "move uncommitted changes into the new worktree")
+	flag.BoolVar(&config.NoLFSSmudge, "no-lfs-smudge", false, "check out Git LFS pointer files without downloading the objects")
+	flag.BoolVar(&config.NoPull, "no-pull", false, "don't pull before creating the worktree")
+	flag.BoolVar(&config.NoFetch, "no-fetch", false, "don't fetch the branch before looking it up on the remote")
+	flag.StringVar(&config.Suffix, "suffix", "", "append -<value> to the branch name, e.g. a ticket ID")
+	flag.BoolVar(&config.Timestamp, "timestamp", false, "append the current time to the branch name")
+	flag.BoolVar(&config.Reset, "reset", false, "reset an existing local branch to the remote branch")
+	flag.BoolVar(&config.PushNew, "push-new", false, "push a newly created branch to the remote and track it")
+	flag.BoolVar(&config.ForceNewBranch, "force-new-branch", false, "create a new branch even if it exists on the remote")
+	flag.BoolVar(&config.NoPrefix, "no-prefix", false, "don't apply worktree.branchprefix to the branch name")
+	flag.BoolVar(&config.Track, "track", false, "set up upstream tracking for new branches")
+	flag.BoolVar(&config.NoTrack, "no-track", false, "don't set up upstream tracking for new branches")
+	flag.DurationVar(&config.PullTimeout, "pull-timeout", 0, "maximum time to wait for the pull (default 30s)")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "print what would be done without doing it")
+	flag.BoolVar(&config.OpenEditor, "editor", false, "open the new worktree in an editor")
+	flag.BoolVar(&config.Tmux, "tmux", false, "open the new worktree in a new tmux window")
+	flag.BoolVar(&config.JSON, "json", false, "print the result as JSON")
+	flag.BoolVar(&config.PrintPath, "print-path", false, "print only the worktree path to stdout")
+	flag.BoolVar(&config.NoChdir, "no-chdir", false, "don't change into the worktree")
+	flag.BoolVar(&config.Quiet, "q", false, "only print errors")
+	flag.BoolVar(&config.Quiet, "quiet", false, "only print errors")
+	flag.BoolVar(&config.NoColor, "no-color", false, "don't color the output")
 	flag.Usage = usage
 	flag.Parse()
 
+	// Ctrl-C cancels the context so that a half-created worktree is cleaned
+	// up, a second one exits right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+		fmt.Fprintln(os.Stderr, config.Paint(os.Stderr, worktree.Yellow, "interrupted, cleaning up…"))
+	}()
+
 	args := flag.Args()
 	if len(args) == 0 {
+		switch {
+		case config.PR > 0, config.Detach:
+			// The branch is named after the pull request, a detached
+			// worktree after the commit
+			args = []string{""}
+		case !isInteractive():
+			usage()
+			os.Exit(1)
+		default:
+			branch, err := selectBranch(ctx, config)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", config.Paint(os.Stderr, worktree.Red, err.Error()))
+				os.Exit(exitCode(err))
+			}
+			args = []string{branch}
+		}
+	}
+
+	err := dispatch(ctx, &config, args)
+	if errors.Is(err, errUsage) {
 		usage()
 		os.Exit(1)
 	}
+	if err != nil {
+		if config.JSON {
+			json.NewEncoder(os.Stdout).Encode(map[string]string{"error": err.Error()})
+		} else {
+			fmt.Fprintf(os.Stderr, "%s\n", config.Paint(os.Stderr, worktree.Red, err.Error()))
+		}
+		os.Exit(exitCode(err))
+	}
+}
 
-	config := &Config{
-		verbose: verbose,
-		logger:  log.New(os.Stderr, "", 0),
+// splitPatterns splits the -copy-patterns value at commas. It never returns
+// nil, an empty value means no patterns.
+func splitPatterns(value string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(value, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
 	}
+	return patterns
+}
 
-	ctx := context.Background()
-	manager := &WorktreeManager{config: config}
+// Exit codes for scripts to tell failures apart
+const (
+	exitFailure       = 1
+	exitNotInGitRepo  = 2
+	exitCreateFailed  = 3
+	exitAuthFailed    = 4
+	exitInvalidBranch = 5
+	exitHookFailed    = 6
+	exitInterrupted   = 130
+)
 
-	if err := manager.CreateWorktree(ctx, args[0]); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", red.Styled(err.Error()))
-		os.Exit(1)
+func exitCode(err error) int {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitInterrupted
+	case errors.Is(err, worktree.ErrNotInGitRepo):
+		return exitNotInGitRepo
+	case errors.Is(err, worktree.ErrWorktreeCreationFailed),
+		errors.Is(err, worktree.ErrWorktreePathExists),
+		errors.Is(err, worktree.ErrBranchExists),
+		errors.Is(err, worktree.ErrStaleWorktree),
+		errors.Is(err, worktree.ErrLocked),
+		errors.Is(err, worktree.ErrBranchInMainWorktree):
+		return exitCreateFailed
+	case errors.Is(err, worktree.ErrAuthFailed):
+		return exitAuthFailed
+	case errors.Is(err, worktree.ErrInvalidBranchName):
+		return exitInvalidBranch
+	case errors.Is(err, worktree.ErrHookFailed):
+		return exitHookFailed
+	default:
+		return exitFailure
 	}
 }
 
 func usage() {
-	fmt.Print(`worktree [-v] <branch name>
+	fmt.Print(`worktree [-v | -vv] [-q] [-no-color] [-config <file>]
+         [-from <ref> | -from-default] [-no-copy] [-copy-from <worktree>]
+         [-copy-patterns <patterns>] [-link] [-hardlink-modules]
+         [-overwrite-copies] [-copy-git-config] [-carry-changes]
+         [-no-lfs-smudge] [-no-pull] [-no-fetch] [-pull-timeout <duration>]
+         [-no-prefix] [-suffix <value>] [-timestamp] [-track | -no-track]
+         [-force-new-branch] [-as-branch] [-reset] [-push-new] [-dry-run]
+         [-editor] [-tmux] [-json] [-print-path] [-no-chdir] [<branch name>]
+worktree -pr <number> [<branch name>]
+worktree -detach [-from <ref>] [<name>]
+worktree list [-v]
+worktree files [<branch name>]
+worktree open <branch name>
+worktree remove [-f] [-d] <branch name>
+worktree move <branch name> <new path>
+worktree prune [-gone]
+worktree config
+worktree <command> [<args>]
+worktree completion <bash|zsh|fish>
 
 create a git worktree with <branch name>. Will create a worktree if one isn't
-found that matches the given name.
+found that matches the given name. New branches are created from HEAD, or from
+<ref> if -from is given. <ref> can be a branch, tag, or commit.
+
+With -from-default, new branches are created from the default branch instead,
+fetched first, so a feature branch isn't accidentally based on another one. The
+default branch is the one the remote's HEAD points to, or main or master. To
+name it explicitly:
+    git config worktree.basebranch "develop"
+
+With -pr, pull request <number> is fetched from the remote into the branch
+pr/<number>, or <branch name> if given, and a worktree is created for it. This
+works for remotes on GitHub and GitLab, where it is called a merge request. An
+existing branch is only fast-forwarded to the pull request. If it has commits
+that are not in the pull request, nothing is changed and worktree fails.
+
+An existing local branch is checked out as is, and a branch that only exists on
+the remote is created from it. Pass -force-new-branch to always create a new
+branch from HEAD or <ref>, even if the remote has a branch of the same name. It
+fails if a local branch of that name exists.
+
+Pass -reset to move an existing local branch to the remote branch before it is
+checked out, so that a reused branch is fresh. If that drops local commits,
+the commit they are still reachable from is printed. A branch that is checked
+out in a worktree is not reset.
+
+Without <branch name>, the local and remote branches are offered in a picker.
+Type to filter, use the arrow keys to select, and press enter to create or
+change into the worktree. A branch named exactly like the typed text is listed
+first. Otherwise the last entry creates a new branch with that name.
+
+If worktree.branchprefix is set, it is prepended to <branch name> unless the
+name already starts with it, names an existing local or remote branch, or
+-no-prefix is given:
+    git config --global worktree.branchprefix "bueti/"
+
+-suffix appends -<value> and -timestamp appends the current time to the
+branch name, for unique throwaway worktrees. With both, the suffix comes first:
+    worktree -timestamp exp       creates exp-20240601-143210
+
+If <branch name> is an issue URL, the branch is named after the issue, and in
+a terminal you can confirm or change the name. Issue keys such as PROJ-123 in
+Jira or Linear URLs are used with the title that follows them, as in
+PROJ-123-fix-login, and GitHub or GitLab issues become issue-<number>. For
+other trackers, set a regular expression whose first group is the name:
+    git config worktree.branchfromurl "tracker\.example\.com/t/([0-9]+)"
+
+With -detach, HEAD or <ref> is checked out in a worktree without creating a
+branch, for a quick look at a commit. The directory is named after <name>, or
+after the commit's short hash.
+
+A <branch name> that is a tag, and no branch, gets a detached worktree at the
+tag the same way, so worktree v1.2.3 doesn't create a branch named v1.2.3. Pass
+-as-branch to create that branch from the tag instead.
+
+Branches created from a remote branch track it, branches created from HEAD or
+<ref> don't. Pass -track or -no-track to override this.
+
+The worktree directory is named after the branch with "/" replaced by "_", so
+feature/login is created in feature_login. If that directory is already the
+worktree of another branch, a short hash of the branch name is appended, as in
+feature_login-1a2b3c4. On a case-insensitive file system, as on macOS, this
+also happens for directories that differ only in case, such as Feature and
+feature, and of copied files that differ only in case only the first is copied.
+Running worktree again for a branch that already has a worktree changes into it
+instead of creating a new one. A branch checked out in the main repository
+can't be checked out again, switch the main repository to another branch
+first, or pass -detach -from <branch name> for a worktree at its commit
+without a branch instead.
+
+Worktrees are created next to the repository by default. To keep them in a
+different directory, set worktree.basedir (or the WORKTREE_BASEDIR environment
+variable). Relative paths are resolved against the repository root:
+    git config worktree.basedir "~/worktrees"
+
+To lay the directories out differently, set worktree.dirtemplate, which is
+expanded below the base directory. {repo} is the name of the repository,
+{branch} the branch name as is, so "/" creates directories, {branch_safe} the
+branch name with "/" replaced, and {hash} a short hash of the branch name:
+    git config worktree.dirtemplate "{repo}-{branch_safe}"
+    git config --global worktree.dirtemplate "{repo}/{branch}"
+
+Branches are pulled from and looked up on the origin remote. In a repository
+without it, nothing is pulled or fetched. To use a different remote:
+    git config worktree.remote "upstream"
+
+Over SSH, the key in worktree.sshkey, the -i option of GIT_SSH_COMMAND, or the
+IdentityFile for the host in ~/.ssh/config is used. If the SSH agent holds that
+key, only it is offered, which avoids "Too many authentication failures" with
+many keys in the agent:
+    git config worktree.sshkey "~/.ssh/id_ed25519_work"
+
+Over HTTP(S), HTTPS_PROXY, HTTP_PROXY, and NO_PROXY are honored. To trust an
+internal CA in addition to the system ones, point worktree.cabundle at a PEM
+file:
+    git config worktree.cabundle "~/certs/corp-ca.pem"
 
 Will copy over some untracked files to the new worktree. By default, this includes
 .env, .envrc, .env.local, .tool-versions, and mise.toml files.
@@ -82,55 +282,258 @@ To set a global configuration for all repositories:
 
 If you have any custom configuration set, it will override the defaults
 completely, so add all files you want copied.
-`)
-}
 
-func (wm *WorktreeManager) CreateWorktree(ctx context.Context, branchname string) error {
-	repo, err := wm.initGitRepo()
-	if err != nil {
-		return err
-	}
-	wm.repo = repo
+To copy additional files only for some branches, add them under a branch glob.
+They are copied on top of the files above for branches matching the glob, where
+* doesn't match a "/":
+    git config --add "worktree.staging/*.untrackedfiles" ".env.staging"
 
-	dirname := strings.ReplaceAll(branchname, "/", "_")
-	worktreePath := filepath.Join("..", dirname)
+Patterns are globs, where * matches any characters except a slash, ? matches a
+single character and [a-z] matches a character class. A pattern must match the
+whole name, so "*.local.json" matches app.local.json but not app.local.json.bak.
+Patterns without a slash match file names anywhere in the repository. Patterns
+with a slash are matched against the path from the repository root, where **
+matches any number of directories. A trailing slash matches directories
+instead of files, which are copied as a whole, and a leading slash only matches
+at the root. Prefix a pattern with re: to use a regular expression instead:
+    git config --add worktree.untrackedfiles "*.local.json"
+    git config --add worktree.untrackedfiles "config/*.local.yaml"
+    git config --add worktree.untrackedfiles ".secrets/"
+    git config --add worktree.untrackedfiles "/.config/"
+    git config --add worktree.untrackedfiles "re:.*\\.local\\.(json|yaml)"
 
-	if err := repo.pull(ctx); err != nil {
-		errStr := err.Error()
-		if strings.Contains(errStr, "no upstream") {
-			// Silent for no upstream - this is common and expected
-		} else if wm.config.verbose {
-			fmt.Fprintf(os.Stderr, "%s\n", yellow.Styled(fmt.Sprintf("Unable to pull: %v", err)))
-		}
-	}
+Patterns starting with "!" exclude what they match from the files matched by
+the other patterns, regardless of their order, and a "!dir/" pattern excludes
+everything below dir. Negations alone exclude from the defaults:
+    git config --add worktree.untrackedfiles ".env*"
+    git config --add worktree.untrackedfiles "!.env.production"
 
-	if err := repo.createWorktree(ctx, branchname, worktreePath); err != nil {
-		return fmt.Errorf("%w: %s", ErrWorktreeCreationFailed, err)
-	}
+To override what is copied for one run, pass -copy-patterns with a
+comma-separated list of patterns. It replaces the configured patterns, the
+defaults, .gitattributes, .worktreefiles, and worktree.copymap below, and
+-copy-patterns= copies nothing:
+    worktree -copy-patterns ".env,config/*.local.yaml" feature/login
 
-	fileCopier := &FileCopier{config: wm.config}
+A repository can commit which files to copy, so that everyone who clones it
+gets them without setting git config. Files given the worktree-copy attribute
+in the .gitattributes file at the repository root are copied on top of the
+patterns above, and those with -worktree-copy are excluded:
+    cfg/*.local.yml  worktree-copy
+    .env.production  -worktree-copy
 
-	if err := fileCopier.copyUntrackedFiles(worktreePath); err != nil {
-		fmt.Fprintf(os.Stderr, "%s\n", yellow.Styled(fmt.Sprintf("Error copying untracked files: %v", err)))
-	}
+To copy exact paths, including directories, list them in a .worktreefiles file
+at the repository root, one per line. Lines starting with # are comments.
 
-	if err := wm.setupDirenv(worktreePath); err != nil {
-		wm.config.logger.Printf("Error setting up direnv: %v", err)
-	}
+To copy a file to a different path in the worktree, for example to seed it from
+a committed template, add it to worktree.copymap as src:dest. An entry without
+a colon is copied to the same path:
+    git config --add worktree.copymap ".env.template:.env"
 
-	if err := os.Chdir(worktreePath); err != nil {
-		return fmt.Errorf("failed to change to worktree directory: %w", err)
-	}
+A file that already exists in the worktree with different content, such as a
+committed file of the same name, is not overwritten, and a warning is printed.
+Pass -overwrite-copies to replace it.
 
-	fmt.Printf("%s\n", green.Styled("created worktree "+worktreePath))
-	return nil
-}
+Symlinks are copied as links. What they point to in the repository is copied
+as well, following chains such as .env -> .env.dev, unless a "!" pattern
+excludes it, and links to files outside the repository are recreated with an
+absolute path.
 
-func (wm *WorktreeManager) setupDirenv(worktreePath string) error {
-	envrcPath := filepath.Join(worktreePath, ".envrc")
-	if _, err := os.Stat(envrcPath); err == nil {
-		cmd := exec.Command("direnv", "allow", worktreePath)
-		return cmd.Run()
-	}
-	return nil
+The files are copied from the repository you run worktree in. Pass -copy-from
+with the path, branch, or directory name of another worktree to copy them from
+there instead, for example when it has more recent local configuration.
+
+Pass -link, or set worktree.linkfiles, to symlink the files to the repository
+instead of copying them, so that all worktrees share one .env. If a symlink
+can't be created, the file is copied:
+    git config worktree.linkfiles true
+
+Pass -hardlink-modules to hardlink the files of a copied node_modules instead
+of copying them, which is faster than even a copy-on-write copy. The files
+share their inodes with the repository, so a package edited in place changes
+in both. node_modules is only copied when it is listed in .worktreefiles or
+worktree.copymap, as the search for patterns skips it.
+
+The search skips node_modules, .git, and vendor directories. To skip a different
+set of directories:
+    git config --add worktree.excludedirs "node_modules"
+    git config --add worktree.excludedirs "dist"
+
+The search is faster with fd installed, as fd or as fdfind on Debian and Ubuntu.
+To use a different binary:
+    git config --global worktree.fdpath "~/bin/fd"
+
+Nested repositories such as submodules are skipped as well. To search them too:
+    git config worktree.includesubmodules true
+
+Untracked files are copied 4 at a time. Lower this to spare a slow disk when
+several worktrees are created at once:
+    git config worktree.copyconcurrency 2
+
+If direnv is installed, a copied .envrc is allowed with direnv allow. If mise
+is installed, a copied mise.toml or .mise.toml is trusted with mise trust.
+All files are copied, and direnv and mise set up, before the worktree is
+reported as created, so it is ready to work in.
+
+After the files are copied, the commands in worktree.postcreate are run in the
+new worktree, in order. They get the branch name and worktree path in
+WORKTREE_BRANCH and WORKTREE_PATH. A failing command stops the sequence, but
+the worktree is kept:
+    git config --add worktree.postcreate "pnpm install"
+
+Worktrees are added with git worktree add. Set worktree.nativeadd to create
+them without the git binary instead. This is experimental: git hooks and
+filters such as Git LFS are not run, and if it fails, git is used after all:
+    git config worktree.nativeadd true
+
+Pass -no-copy to skip copying untracked files and get a pristine worktree.
+
+Pass -copy-git-config to give the new worktree its own copy of the repository
+or current worktree's user.name, user.email, and user.signingkey, to edit there
+without affecting the other worktrees. This enables extensions.worktreeConfig.
+To copy other keys, and to install a separate set of hooks for the worktree:
+    git config --add worktree.gitconfigkeys "user.email"
+    git config worktree.hooksdir "~/hooks/client"
+
+Pass -carry-changes to move the uncommitted changes to tracked files into the
+new worktree, for when work turns out to belong on a new branch. They are
+stashed and popped in the new worktree. If they don't apply cleanly, they are
+left in the stash.
+
+Pass -no-lfs-smudge to check out Git LFS files as pointers instead of
+downloading them, which is much faster in repositories with large LFS files.
+Run git lfs pull in the worktree to fetch them later.
+
+Pass -no-pull to skip pulling the current branch before creating the worktree,
+for example when offline. The pull gives up after 30 seconds. To change this,
+pass -pull-timeout or set worktree.pulltimeout:
+    git config worktree.pulltimeout "1m"
+
+Before a branch that doesn't exist locally is looked up on the remote, it is
+fetched, so that a branch pushed since the last fetch is checked out instead of
+created anew. Pass -no-fetch to skip this, for example when offline. It uses
+the same timeout as the pull.
+
+A pull that fails with a network error such as a reset connection or a timeout
+can be retried, waiting 1s, 2s, 4s, and so on between attempts, within the
+pull timeout:
+    git config worktree.pullretries 3
+
+Pass -push-new to push a newly created branch to the remote once the worktree
+is set up, and track it there, so that others see it right away. A branch
+that was checked out or created from the remote is not pushed. If the push
+fails, the worktree is kept. Like the pull, it gives up after the pull timeout.
+
+Pass -dry-run to print the branch, worktree path, files to copy, and direnv
+setup that would happen, without changing anything.
+
+Pass -editor to open the new worktree in an editor once it is set up. The
+editor is taken from worktree.editor, then $VISUAL, then $EDITOR:
+    git config --global worktree.editor "code"
+
+Pass -tmux to open the new worktree in a new tmux window named after the branch,
+when run inside tmux. To run a different command, set worktree.tmuxcmd, which
+gets the same environment as the post-create hooks:
+    git config --global worktree.tmuxcmd 'tmux new-window -c "$WORKTREE_PATH"'
+
+Once the worktree is ready, how many commits its branch is ahead of and behind
+its upstream, or else the default branch, is printed, to tell whether it needs
+a rebase. A new worktree is followed by a plain summary of its branch, path,
+what it was created from, how many files were copied, whether node_modules was
+copied, whether direnv allowed the .envrc, and how long it took.
+
+Pass -json to print a single JSON object with the branch, worktree path,
+whether the branch was created, what it was created from, the copied files,
+the node_modules and direnv status, the commits ahead of and behind the base,
+and any warnings. With -dry-run, it is what would be created, with "dry_run"
+set. Errors are printed as a JSON object with an "error" field.
+
+Pass -print-path to print only the absolute worktree path to stdout, with all
+other output going to stderr. This allows a shell function to change into the
+new worktree:
+    wt() { cd "$(worktree -print-path "$1")"; }
+
+When it is done, worktree changes its own current directory into the new
+worktree, which matters to programs using it as a library. Pass -no-chdir to
+stay in the current directory instead. -print-path implies it.
+
+Pass -vv to log every command that is run, such as git, cp, and fd, with its
+arguments, and its exit code and duration once it finishes, on top of -v.
+Tokens and passwords in the arguments are hidden.
+
+Pass -q to print only errors, for use in scripts. Success messages, warnings,
+and progress are not printed.
+
+Output is colored when it goes to a terminal. Pass -no-color or set NO_COLOR
+to turn colors off.
+
+The worktree.* settings can also be kept in a YAML file, so they apply to all
+repositories without touching git config. It is read from -config, or from
+~/.config/worktree/config.yaml if it exists. The keys are the git config keys
+without "worktree.", and lists set multi-valued keys:
+    basedir: ~/worktrees
+    untrackedfiles: [.env, .envrc]
+    postcreate:
+      - pnpm install
+
+Flags take precedence over git config, which takes precedence over the config
+file, which takes precedence over the defaults. The branch-scoped
+untrackedfiles are only read from git config.
+
+config prints the settings creating a worktree here would use, such as the
+base directory, remote, copy patterns, fd binary, and post-create hooks, each
+with where it comes from: a flag, the environment, git config, the config
+file, or the default. Global flags given before config are taken into account:
+    worktree -no-prefix config
+
+list shows all worktrees of the repository with their branch and HEAD. The
+current worktree is shown in green, detached worktrees in yellow. With -v,
+the upstream branch and whether the worktree has uncommitted changes are
+shown as well.
+
+files prints the untracked files that would be copied into a new worktree,
+without creating one, to check the patterns above. With <branch name>, the
+patterns for that branch are included. Whether node_modules would be copied,
+linked, hardlinked, or skipped is printed to stderr.
+
+open starts a shell in the existing worktree for <branch name>, which can also
+be the name of the worktree directory. With -print-path, only the path is
+printed instead, so a shell function can change into it:
+    wto() { cd "$(worktree -print-path open "$1")"; }
+
+remove deletes the worktree for <branch name>. It refuses to remove a worktree
+with uncommitted or untracked changes unless -f is given, and never removes the
+main worktree. With -d, the local branch is deleted as well.
+
+move moves the worktree for <branch name> to <new path>, for example onto a
+faster disk. The path must not exist yet, and the main worktree can't be moved.
+
+prune cleans up administrative data for worktrees whose directories no longer
+exist. With -gone, it also offers to remove clean worktrees whose upstream
+branch has been deleted on the remote.
+
+completion prints a shell completion script that completes subcommands, flags,
+and branch names. For example, in ~/.bashrc:
+    source <(worktree completion bash)
+
+Like git, worktree runs an executable named worktree-<command> on PATH for a
+<command> that is not one of the above, with the arguments following it, and
+exits with its exit code. A branch named <command> takes precedence, and
+without either, a worktree is created for the new branch <command>.
+
+Concurrent invocations in the same repository create their branches and
+worktrees one at a time, waiting for up to 30 seconds for each other. The
+lock on .git/worktree-tool.lock is released when its holder exits, so a
+crashed invocation doesn't block the next one.
+
+Exit codes:
+    0    success
+    1    any other error
+    2    not in a git repository
+    3    the worktree couldn't be created, for example because its path or
+         branch already exists or another invocation holds the lock
+    4    authentication with the remote failed
+    5    invalid branch name
+    6    a post-create hook failed
+    130  interrupted with Ctrl-C
+`)
 }
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/bueti/go-worktree/worktree"
+	"github.com/mattn/go-isatty"
+)
+
+var ErrNoBranchSelected = errors.New("no branch selected")
+
+const pickerHeight = 10
+
+func isInteractive() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// selectBranch offers the local and remote branches in a picker.
+func selectBranch(ctx context.Context, config worktree.Config) (string, error) {
+	branches, err := worktree.NewWorktreeManager(config).Branches(ctx)
+	if err != nil {
+		return "", err
+	}
+	return pickBranch(&config, branches)
+}
+
+// branchFromURL returns the branch name for an issue URL, which the user can
+// confirm or change in interactive mode. Without a match, the URL is returned
+// as is.
+func branchFromURL(config worktree.Config, rawURL string) (string, error) {
+	branch, ok, err := worktree.NewWorktreeManager(config).BranchFromURL(rawURL)
+	if err != nil || !ok {
+		return rawURL, err
+	}
+	if !isInteractive() {
+		return branch, nil
+	}
+
+	fmt.Fprintf(os.Stderr, "branch name [%s]: ", branch)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer, nil
+	}
+	return branch, nil
+}
+
+// pickBranch lets the user choose one of branches with the arrow keys. Typing
+// filters the list, with a branch named exactly like the typed text first.
+// Unless a branch has that name, the last entry creates it as a new branch.
+func pickBranch(config *worktree.Config, branches []string) (string, error) {
+	restore, err := rawMode()
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	var query string
+	selected := 0
+	lines := 0
+	buf := make([]byte, 256)
+
+	for {
+		matches, create := filterBranches(branches, query)
+		selected = max(0, min(selected, pickerEntries(matches, create)-1))
+		lines = renderPicker(config, query, matches, create, selected, lines)
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return "", err
+		}
+
+		// A single read can hold several keys when typing fast or pasting
+		for input := buf[:n]; len(input) > 0; {
+			key := input[0]
+			input = input[1:]
+
+			switch {
+			case key == 0x1b && len(input) >= 2 && input[0] == '[':
+				switch input[1] {
+				case 'A':
+					selected--
+				case 'B':
+					selected++
+				}
+				input = input[2:]
+			case key == '\r' || key == '\n':
+				clearPicker(lines)
+				matches, create := filterBranches(branches, query)
+				selected = max(0, min(selected, pickerEntries(matches, create)-1))
+				if selected < len(matches) {
+					return matches[selected], nil
+				}
+				if create {
+					return query, nil
+				}
+				return "", ErrNoBranchSelected
+			case key == 0x03 || key == 0x1b:
+				clearPicker(lines)
+				return "", ErrNoBranchSelected
+			case key == 0x7f || key == 0x08:
+				if query != "" {
+					query = query[:len(query)-1]
+				}
+			case key >= 0x20 && key < 0x7f:
+				query += string(key)
+				selected = 0
+			}
+		}
+	}
+}
+
+// filterBranches returns the branches containing query, the one named query
+// first, and whether to offer creating query as a new branch, which is when
+// query isn't empty and no branch has that name.
+func filterBranches(branches []string, query string) ([]string, bool) {
+	var matches []string
+	exact := false
+	for _, branch := range branches {
+		switch {
+		case branch == query:
+			matches = append([]string{branch}, matches...)
+			exact = true
+		case strings.Contains(strings.ToLower(branch), strings.ToLower(query)):
+			matches = append(matches, branch)
+		}
+	}
+	return matches, query != "" && !exact
+}
+
+// pickerEntries returns the number of entries in the picker, the matches and
+// the one creating a new branch.
+func pickerEntries(matches []string, create bool) int {
+	if create {
+		return len(matches) + 1
+	}
+	return len(matches)
+}
+
+// renderPicker draws the picker on stderr, replacing the previous drawing of
+// previousLines lines, and returns how many lines it drew.
+func renderPicker(config *worktree.Config, query string, matches []string, create bool, selected, previousLines int) int {
+	clearPicker(previousLines)
+
+	entries := pickerEntries(matches, create)
+	start := max(0, selected-pickerHeight+1)
+	end := min(entries, start+pickerHeight)
+
+	lines := 0
+	for i := start; i < end; i++ {
+		entry := "create new branch " + query
+		if i < len(matches) {
+			entry = matches[i]
+		}
+		switch {
+		case i == selected:
+			fmt.Fprintf(os.Stderr, "%s\r\n", config.Paint(os.Stderr, worktree.Green, "> "+entry))
+		case i >= len(matches):
+			fmt.Fprintf(os.Stderr, "%s\r\n", config.Paint(os.Stderr, worktree.Yellow, "  "+entry))
+		default:
+			fmt.Fprintf(os.Stderr, "  %s\r\n", entry)
+		}
+		lines++
+	}
+	fmt.Fprintf(os.Stderr, "branch: %s", query)
+	return lines
+}
+
+func clearPicker(lines int) {
+	// Move to the start of the prompt line, then up over the list, clearing
+	// everything below
+	fmt.Fprint(os.Stderr, "\r")
+	if lines > 0 {
+		fmt.Fprintf(os.Stderr, "\x1b[%dA", lines)
+	}
+	fmt.Fprint(os.Stderr, "\x1b[J")
+}
+
+func rawMode() (func(), error) {
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("failed to set up the terminal: %w", err)
+	}
+	return func() { stty("-raw", "echo") }, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFilterBranches(t *testing.T) {
+	branches := []string{"a-fix", "feature", "feature-login", "fix", "main"}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantMatches []string
+		wantCreate  bool
+	}{
+		{name: "empty query", query: "", wantMatches: branches},
+		{name: "exact match", query: "feature", wantMatches: []string{"feature", "feature-login"}},
+		{name: "exact match before earlier substring matches", query: "fix", wantMatches: []string{"fix", "a-fix"}},
+		{name: "substring of branches", query: "feat", wantMatches: []string{"feature", "feature-login"}, wantCreate: true},
+		{name: "case insensitive", query: "MAIN", wantMatches: []string{"main"}, wantCreate: true},
+		{name: "no match", query: "release", wantCreate: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches, create := filterBranches(branches, tt.query)
+			if !slices.Equal(matches, tt.wantMatches) || create != tt.wantCreate {
+				t.Errorf("filterBranches(%q) = %q, %v, want %q, %v", tt.query, matches, create, tt.wantMatches, tt.wantCreate)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package worktree
+
+import (
+	"os"
+	"strings"
+)
+
+// copyAttribute marks the untracked files to copy into new worktrees in
+// .gitattributes, so that a repository can commit its copy policy.
+const copyAttribute = "worktree-copy"
+
+// attributePatterns returns the patterns of the .gitattributes file at the
+// root of the directory the files are copied from that set copyAttribute,
+// and, negated, those that unset it. Unlike git, it doesn't read the
+// .gitattributes files of subdirectories, expand macros, or unquote patterns.
+func (fc *FileCopier) attributePatterns() []string {
+	data, err := os.ReadFile(fc.source(".gitattributes"))
+	if err != nil {
+		return nil
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], `"`) {
+			continue
+		}
+
+		// The last occurrence of the attribute on a line wins
+		state := ""
+		for _, attr := range fields[1:] {
+			switch attr {
+			case copyAttribute, copyAttribute + "=true":
+				state = "set"
+			case "-" + copyAttribute, "!" + copyAttribute, copyAttribute + "=false":
+				state = "unset"
+			}
+		}
+		if state == "" {
+			continue
+		}
+
+		pattern, err := attributeGlob(fields[0])
+		if err != nil {
+			fc.config.warnf("Ignoring invalid .gitattributes pattern %q: %v", fields[0], err)
+			continue
+		}
+		if state == "unset" {
+			pattern = "!" + pattern
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// attributeGlob returns the untracked file pattern for a .gitattributes
+// pattern, which is always a glob, even if it would be taken for a regular
+// expression.
+func attributeGlob(pattern string) (string, error) {
+	if !legacyRegexp(pattern) && !strings.HasPrefix(pattern, "re:") {
+		return pattern, nil
+	}
+	expr, err := globRegexp(strings.TrimPrefix(pattern, "/"))
+	if err != nil {
+		return "", err
+	}
+	return "re:" + expr, nil
+}
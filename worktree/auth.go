@@ -0,0 +1,380 @@
+package worktree
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/kevinburke/ssh_config"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// getAuth returns the auth method for the remote. It is resolved once and
+// reused, so that credential helpers don't run or prompt again for each fetch.
+func (r *GitRepo) getAuth() (transport.AuthMethod, error) {
+	if r.authResolved {
+		return r.auth, nil
+	}
+	auth, err := r.resolveAuth()
+	if err != nil {
+		return nil, err
+	}
+	r.auth, r.authResolved = auth, true
+	return auth, nil
+}
+
+func (r *GitRepo) resolveAuth() (transport.AuthMethod, error) {
+	remoteURL, err := r.remoteURL()
+	if err != nil {
+		return nil, err
+	}
+
+	// Parsed the way go-git will, which also covers scp-like user@host:path
+	// URLs and local paths
+	endpoint, err := transport.NewEndpoint(remoteURL)
+	if err != nil {
+		// The parse error repeats the URL, with any password in it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid URL %q for %s remote: %w", redact(remoteURL), r.remote, err)
+	}
+
+	switch endpoint.Protocol {
+	case "ssh":
+		return r.getSSHAuth(endpoint.Host)
+	case "https":
+		// Try to get a token from the provider CLI or git credential helper
+		return r.getHTTPSAuth(remoteURL)
+	case "http":
+		// Credentials would be sent in the clear, so only anonymous access
+		return nil, nil
+	case "file", "git":
+		// Local repositories and the git protocol have no authentication
+		return nil, nil
+	default:
+		r.config.warnf("Unknown protocol %q in the URL of the %s remote, trying without authentication", endpoint.Protocol, r.remote)
+		return nil, nil
+	}
+}
+
+// remoteURL returns the first URL of the remote.
+func (r *GitRepo) remoteURL() (string, error) {
+	remote, err := r.repository.Remote(r.remote)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s remote: %w", r.remote, err)
+	}
+
+	if len(remote.Config().URLs) == 0 {
+		return "", fmt.Errorf("no URLs configured for %s remote", r.remote)
+	}
+
+	return remote.Config().URLs[0], nil
+}
+
+func (r *GitRepo) getSSHAuth(host string) (transport.AuthMethod, error) {
+	explicitKeys := r.explicitSSHKeys()
+	configKeys := sshConfigKeys(host)
+
+	agentAuth, agentErr := ssh.NewSSHAgentAuth("git")
+	if agentErr == nil {
+		// Servers give up after a few rejected keys, so if an identity is
+		// configured and the agent has it, only that one is offered
+		if auth := agentAuthFor(agentAuth, append(explicitKeys, configKeys...)); auth != nil {
+			return auth, nil
+		}
+	}
+
+	// Explicitly configured keys take precedence over the agent, one that
+	// can't be loaded falls back to it
+	for _, sshKey := range explicitKeys {
+		auth, err := r.loadSSHKey(sshKey)
+		if err == nil {
+			return auth, nil
+		}
+		r.config.warnf("%v, trying the SSH agent and other keys", err)
+	}
+
+	if agentErr == nil {
+		return agentAuth, nil
+	}
+
+	// Fallback to the keys configured for this host in ~/.ssh/config
+	for _, sshKey := range configKeys {
+		if _, err := os.Stat(sshKey); err == nil {
+			if auth, err := r.loadSSHKey(sshKey); err == nil {
+				return auth, nil
+			}
+		}
+	}
+
+	// Fallback to default SSH keys if agent fails
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	// Try common SSH key names
+	keyNames := []string{"id_rsa", "id_ed25519", "id_ecdsa", "id_dsa"}
+	for _, keyName := range keyNames {
+		sshKey := filepath.Join(homeDir, ".ssh", keyName)
+		if _, err := os.Stat(sshKey); err == nil {
+			auth, err := r.loadSSHKey(sshKey)
+			if err == nil {
+				return auth, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no SSH keys found or SSH agent not available")
+}
+
+// agentAuthFor restricts agentAuth to the agent keys matching the public keys
+// of sshKeys, read from their .pub files. It returns nil if there is no such
+// key in the agent.
+func agentAuthFor(agentAuth *ssh.PublicKeysCallback, sshKeys []string) transport.AuthMethod {
+	var wanted [][]byte
+	for _, sshKey := range sshKeys {
+		data, err := os.ReadFile(sshKey + ".pub")
+		if err != nil {
+			continue
+		}
+		publicKey, _, _, _, err := gossh.ParseAuthorizedKey(data)
+		if err != nil {
+			continue
+		}
+		wanted = append(wanted, publicKey.Marshal())
+	}
+	if len(wanted) == 0 {
+		return nil
+	}
+
+	signers, err := agentAuth.Callback()
+	if err != nil {
+		return nil
+	}
+	var matched []gossh.Signer
+	for _, signer := range signers {
+		key := signer.PublicKey().Marshal()
+		if slices.ContainsFunc(wanted, func(w []byte) bool { return bytes.Equal(w, key) }) {
+			matched = append(matched, signer)
+		}
+	}
+	if len(matched) == 0 {
+		return nil
+	}
+
+	filtered := *agentAuth
+	filtered.Callback = func() ([]gossh.Signer, error) {
+		return matched, nil
+	}
+	return &filtered
+}
+
+// explicitSSHKeys returns keys set via worktree.sshkey or the -i option of
+// GIT_SSH_COMMAND.
+func (r *GitRepo) explicitSSHKeys() []string {
+	var keys []string
+
+	if key := r.config.configValue("worktree.sshkey"); key != "" {
+		keys = append(keys, expandHome(key))
+	}
+
+	fields := strings.Fields(os.Getenv("GIT_SSH_COMMAND"))
+	for i, field := range fields {
+		if field == "-i" && i+1 < len(fields) {
+			keys = append(keys, expandHome(fields[i+1]))
+		} else if strings.HasPrefix(field, "-i") && len(field) > 2 {
+			keys = append(keys, expandHome(field[2:]))
+		}
+	}
+
+	return keys
+}
+
+func sshConfigKeys(host string) []string {
+	if host == "" {
+		return nil
+	}
+
+	var keys []string
+	for _, key := range ssh_config.GetAll(host, "IdentityFile") {
+		keys = append(keys, expandHome(key))
+	}
+	return keys
+}
+
+func (r *GitRepo) loadSSHKey(sshKey string) (transport.AuthMethod, error) {
+	pemBytes, err := os.ReadFile(sshKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key %s: %w", sshKey, err)
+	}
+
+	auth, err := ssh.NewPublicKeys("git", pemBytes, "")
+	var missing *gossh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		passphrase, err := r.promptPassphrase(sshKey)
+		if err != nil {
+			return nil, err
+		}
+		auth, err = ssh.NewPublicKeys("git", pemBytes, passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", sshKey, err)
+		}
+		return auth, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH key %s: %w", sshKey, err)
+	}
+	return auth, nil
+}
+
+func (r *GitRepo) promptPassphrase(sshKey string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", sshKey)
+
+	// Disable echo while the passphrase is typed
+	stty := func(arg string) {
+		cmd := r.config.tracer.command("stty", arg)
+		cmd.Stdin = os.Stdin
+		cmd.Run()
+	}
+	stty("-echo")
+	defer func() {
+		stty("echo")
+		fmt.Fprintln(os.Stderr)
+	}()
+
+	passphrase, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && passphrase == "" {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(passphrase, "\r\n"), nil
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(homeDir, strings.TrimPrefix(path, "~"))
+}
+
+func (r *GitRepo) getHTTPSAuth(remoteURL string) (transport.AuthMethod, error) {
+	parsed, err := url.Parse(remoteURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote URL: %w", err)
+	}
+	host := parsed.Hostname()
+
+	switch {
+	case host == "github.com":
+		if token, err := r.getGitHubToken(); err == nil {
+			return &http.BasicAuth{
+				Username: "token",
+				Password: token,
+			}, nil
+		}
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		if token, err := r.getGitLabToken(host); err == nil {
+			return &http.BasicAuth{
+				Username: "oauth2",
+				Password: token,
+			}, nil
+		}
+	}
+
+	// Try git credential helper, which also covers Bitbucket and any other host
+	if username, password, err := r.getGitCredentials(remoteURL); err == nil {
+		if username == "" {
+			username = defaultHTTPSUsername(host)
+		}
+		return &http.BasicAuth{
+			Username: username,
+			Password: password,
+		}, nil
+	}
+
+	if host == "github.com" {
+		return nil, fmt.Errorf("no HTTPS authentication method found for %s", host)
+	}
+
+	// Other hosts may allow anonymous access, so leave it to the default
+	return nil, nil
+}
+
+func defaultHTTPSUsername(host string) string {
+	switch {
+	case host == "bitbucket.org":
+		return "x-token-auth"
+	case host == "gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return "oauth2"
+	default:
+		return "token"
+	}
+}
+
+func (r *GitRepo) getGitHubToken() (string, error) {
+	cmd := r.config.tracer.command("gh", "auth", "token")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func (r *GitRepo) getGitLabToken(host string) (string, error) {
+	if token := os.Getenv("GITLAB_TOKEN"); token != "" {
+		return token, nil
+	}
+
+	cmd := r.config.tracer.command("glab", "auth", "token", "--hostname", host)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(output))
+	if token == "" {
+		return "", fmt.Errorf("glab returned an empty token")
+	}
+	return token, nil
+}
+
+func (r *GitRepo) getGitCredentials(url string) (string, string, error) {
+	cmd := r.config.tracer.command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("url=%s\n", url))
+	// Never prompt; only use credentials that are already stored
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", "", err
+	}
+
+	var username, password string
+	lines := strings.Split(string(output), "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(line, "username=") {
+			username = strings.TrimPrefix(line, "username=")
+		}
+		if strings.HasPrefix(line, "password=") {
+			password = strings.TrimPrefix(line, "password=")
+		}
+	}
+
+	if password == "" {
+		return "", "", fmt.Errorf("no password found in git credentials")
+	}
+	return username, password, nil
+}
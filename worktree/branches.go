@@ -0,0 +1,108 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+var ErrInvalidBranchName = errors.New("invalid branch name")
+
+// Branches returns the names of the local branches and the branches on the
+// remote, sorted and without duplicates.
+func (wm *WorktreeManager) Branches(ctx context.Context) ([]string, error) {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return nil, err
+	}
+	wm.repo = repo
+
+	return repo.branchNames()
+}
+
+func (r *GitRepo) branchNames() ([]string, error) {
+	refs, err := r.repository.References()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get references: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	remotePrefix := r.remote + "/"
+	err = refs.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name()
+		switch {
+		case name.IsBranch():
+			seen[name.Short()] = true
+		case name.IsRemote() && strings.HasPrefix(name.Short(), remotePrefix):
+			branch := strings.TrimPrefix(name.Short(), remotePrefix)
+			if branch != "HEAD" {
+				seen[branch] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list branches: %w", err)
+	}
+
+	branches := make([]string, 0, len(seen))
+	for branch := range seen {
+		branches = append(branches, branch)
+	}
+	sort.Strings(branches)
+	return branches, nil
+}
+
+// validateBranchName checks branchname against the rules of
+// git check-ref-format --branch, so that an invalid name is rejected before
+// anything is created.
+func validateBranchName(branchname string) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidBranchName, branchname, reason)
+	}
+
+	switch {
+	case branchname == "":
+		return invalid("empty")
+	case branchname == "@":
+		return invalid(`"@" is not allowed`)
+	case strings.HasPrefix(branchname, "-"):
+		return invalid(`starts with "-"`)
+	case strings.HasPrefix(branchname, "/"), strings.HasSuffix(branchname, "/"):
+		return invalid(`starts or ends with "/"`)
+	case strings.HasSuffix(branchname, "."):
+		return invalid(`ends with "."`)
+	case strings.Contains(branchname, "//"):
+		return invalid(`contains "//"`)
+	case strings.Contains(branchname, ".."):
+		return invalid(`contains ".."`)
+	case strings.Contains(branchname, "@{"):
+		return invalid(`contains "@{"`)
+	}
+
+	for _, c := range branchname {
+		switch {
+		case c < 0x20 || c == 0x7f:
+			return invalid(fmt.Sprintf("contains control character %U", c))
+		case c == ' ':
+			return invalid("contains a space")
+		case strings.ContainsRune(`~^:?*[\`, c):
+			return invalid(fmt.Sprintf("contains %q", string(c)))
+		}
+	}
+
+	for _, component := range strings.Split(branchname, "/") {
+		if strings.HasPrefix(component, ".") {
+			return invalid(fmt.Sprintf("component %q starts with \".\"", component))
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return invalid(fmt.Sprintf("component %q ends with \".lock\"", component))
+		}
+	}
+
+	return nil
+}
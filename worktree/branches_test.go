@@ -0,0 +1,52 @@
+package worktree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateBranchName(t *testing.T) {
+	tests := []struct {
+		branchname string
+		valid      bool
+	}{
+		{"main", true},
+		{"feature/login", true},
+		{"fix-123_a.b", true},
+		{"PROJ-123-fix-login", true},
+		{"", false},
+		{"@", false},
+		{"-feature", false},
+		{"/feature", false},
+		{"feature/", false},
+		{"feature.", false},
+		{"feature//login", false},
+		{"feature..login", false},
+		{"feature@{1}", false},
+		{"feature login", false},
+		{"feature\tlogin", false},
+		{"feature\x7f", false},
+		{"feature~1", false},
+		{"feature^", false},
+		{"feature:login", false},
+		{"feature?", false},
+		{"feature*", false},
+		{"feature[1]", false},
+		{`feature\login`, false},
+		{".feature", false},
+		{"feature/.login", false},
+		{"feature.lock", false},
+		{"feature.lock/login", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.branchname, func(t *testing.T) {
+			err := validateBranchName(tt.branchname)
+			if tt.valid && err != nil {
+				t.Errorf("validateBranchName(%q) = %v, want nil", tt.branchname, err)
+			}
+			if !tt.valid && !errors.Is(err, ErrInvalidBranchName) {
+				t.Errorf("validateBranchName(%q) = %v, want ErrInvalidBranchName", tt.branchname, err)
+			}
+		})
+	}
+}
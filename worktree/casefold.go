@@ -0,0 +1,62 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// caseCollision reports whether the paths a and b differ only in case, so
+// that they name the same file on a case-insensitive file system such as the
+// default one on macOS.
+func caseCollision(a, b string) bool {
+	return a != b && strings.EqualFold(a, b)
+}
+
+// sameFile reports whether the paths a and b name the same existing file.
+func sameFile(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	return err == nil && os.SameFile(aInfo, bInfo)
+}
+
+// caseInsensitiveDir reports whether dir is on a case-insensitive file system,
+// by looking it up under its name with the case swapped. A name without
+// letters can't tell, it is reported as case-sensitive.
+func caseInsensitiveDir(dir string) bool {
+	name := filepath.Base(dir)
+	swapped := strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, name)
+	if swapped == name {
+		return false
+	}
+
+	return sameFile(dir, filepath.Join(filepath.Dir(dir), swapped))
+}
+
+// dropCaseCollisions returns entries without those whose destination
+// collides with an earlier one's on a case-insensitive file system, such as
+// .ENV after .env, warning about each. The earlier entry wins, as it does
+// for identical destinations.
+func (fc *FileCopier) dropCaseCollisions(entries []copyEntry) []copyEntry {
+	first := make(map[string]string)
+	kept := entries[:0:0]
+	for _, entry := range entries {
+		key := strings.ToLower(entry.dest)
+		if dest, ok := first[key]; ok && caseCollision(dest, entry.dest) {
+			fc.config.warnf("Not copying %s, it is the same file as %s on this case-insensitive file system", entry.dest, dest)
+			continue
+		}
+		first[key] = entry.dest
+		kept = append(kept, entry)
+	}
+	return kept
+}
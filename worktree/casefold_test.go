@@ -0,0 +1,88 @@
+package worktree
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCaseCollision(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{".env", ".env", false},
+		{".env", ".ENV", true},
+		{"/tmp/Feature", "/tmp/feature", true},
+		{"/tmp/feature", "/tmp/feature-1", false},
+		{"Straße", "STRASSE", false},
+		{"ÄPFEL", "äpfel", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.a+" "+tt.b, func(t *testing.T) {
+			if got := caseCollision(tt.a, tt.b); got != tt.want {
+				t.Errorf("caseCollision(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropCaseCollisions(t *testing.T) {
+	entry := func(dest string) copyEntry {
+		return copyEntry{src: "src/" + dest, dest: dest}
+	}
+	tests := []struct {
+		name     string
+		entries  []copyEntry
+		want     []copyEntry
+		warnings int
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:    "no collisions",
+			entries: []copyEntry{entry(".env"), entry(".envrc"), entry("app/.env")},
+			want:    []copyEntry{entry(".env"), entry(".envrc"), entry("app/.env")},
+		},
+		{
+			name:     "collision",
+			entries:  []copyEntry{entry(".env"), entry(".ENV")},
+			want:     []copyEntry{entry(".env")},
+			warnings: 1,
+		},
+		{
+			name:     "the first wins",
+			entries:  []copyEntry{entry(".ENV"), entry(".env"), entry(".Env")},
+			want:     []copyEntry{entry(".ENV")},
+			warnings: 2,
+		},
+		{
+			name:     "collision in a directory",
+			entries:  []copyEntry{entry("App/.env"), entry("app/.env"), entry("app/.envrc")},
+			want:     []copyEntry{entry("App/.env"), entry("app/.envrc")},
+			warnings: 1,
+		},
+		{
+			name:    "identical destinations",
+			entries: []copyEntry{entry(".env"), entry(".env")},
+			want:    []copyEntry{entry(".env"), entry(".env")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			fc := &FileCopier{config: &Config{Logger: log.New(&output, "", 0)}}
+			got := fc.dropCaseCollisions(tt.entries)
+			if len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Errorf("dropCaseCollisions = %v, want %v", got, tt.want)
+			}
+			if warnings := strings.Count(output.String(), "Not copying"); warnings != tt.warnings {
+				t.Errorf("dropCaseCollisions warned %d times, want %d:\n%s", warnings, tt.warnings, output.String())
+			}
+		})
+	}
+}
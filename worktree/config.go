@@ -0,0 +1,122 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrInvalidConfigFile = errors.New("invalid config file")
+
+// loadConfigFile reads Config.ConfigFile, or ~/.config/worktree/config.yaml if
+// it exists. Its keys are the worktree.* git config keys without the prefix,
+// for example:
+//
+//	basedir: ~/worktrees
+//	untrackedfiles: [.env, .envrc]
+//	postcreate:
+//	  - pnpm install
+func (c *Config) loadConfigFile() error {
+	if c.file != nil {
+		return nil
+	}
+	c.file = make(map[string][]string)
+
+	path := c.configFilePath()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	var settings map[string]any
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrInvalidConfigFile, path, err)
+	}
+
+	for key, value := range settings {
+		key = "worktree." + strings.ToLower(key)
+		switch value := value.(type) {
+		case []any:
+			for _, v := range value {
+				c.file[key] = append(c.file[key], fmt.Sprint(v))
+			}
+		case map[string]any:
+			return fmt.Errorf("%w %s: %s must be a value or a list", ErrInvalidConfigFile, path, key)
+		case nil:
+		default:
+			c.file[key] = []string{fmt.Sprint(value)}
+		}
+	}
+	return nil
+}
+
+// configFilePath returns Config.ConfigFile, or the default config file if it
+// exists, or "" if there is none.
+func (c *Config) configFilePath() string {
+	if c.ConfigFile != "" {
+		return c.ConfigFile
+	}
+	path := defaultConfigFile()
+	if _, err := os.Stat(expandHome(path)); err != nil {
+		return ""
+	}
+	return path
+}
+
+func defaultConfigFile() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "worktree", "config.yaml")
+	}
+	return filepath.Join("~", ".config", "worktree", "config.yaml")
+}
+
+// configValue returns a setting from git config, or from the config file if
+// git config doesn't have it.
+func (c *Config) configValue(key string) string {
+	if value := c.gitConfigValue(key); value != "" {
+		return value
+	}
+	if values := c.file[key]; len(values) > 0 {
+		return values[len(values)-1]
+	}
+	return ""
+}
+
+// configValues returns a multi-valued setting from git config, or from the
+// config file if git config doesn't have it.
+func (c *Config) configValues(key string) []string {
+	if values := c.gitConfigValues(key); len(values) > 0 {
+		return values
+	}
+	return c.file[key]
+}
+
+// configBool returns a boolean setting from git config, or from the config
+// file if git config doesn't have it.
+func (c *Config) configBool(key string) bool {
+	if c.gitConfigValue(key) != "" {
+		return c.gitConfigBool(key)
+	}
+	values := c.file[key]
+	return len(values) > 0 && values[len(values)-1] == "true"
+}
+
+// configSource returns where configValue, configValues, and configBool find
+// key: sourceGitConfig, sourceFile, or sourceDefault if neither has it.
+func (c *Config) configSource(key string) string {
+	switch {
+	case len(c.gitConfigValues(key)) > 0:
+		return sourceGitConfig
+	case len(c.file[key]) > 0:
+		return sourceFile
+	default:
+		return sourceDefault
+	}
+}
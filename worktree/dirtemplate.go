@@ -0,0 +1,79 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidDirTemplate = errors.New("invalid worktree.dirtemplate")
+
+var placeholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// worktreeDir returns the directory for the worktree of name, relative to the
+// base directory. Without worktree.dirtemplate, it is the name with slashes
+// replaced. The template may use {repo}, the name of the repository, {branch},
+// the name as is so slashes create directories, {branch_safe}, the name with
+// slashes replaced, and {hash}, a short hash of the name.
+func (r *GitRepo) worktreeDir(name string) (string, error) {
+	template := r.config.configValue("worktree.dirtemplate")
+	if template == "" {
+		return worktreeDirName(name), nil
+	}
+
+	var unknown []string
+	var repoErr error
+	dir := placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{repo}":
+			repo, err := r.repoName()
+			if err != nil {
+				repoErr = err
+			}
+			return repo
+		case "{branch}":
+			return name
+		case "{branch_safe}":
+			return worktreeDirName(name)
+		case "{hash}":
+			return branchHash(name)
+		default:
+			unknown = append(unknown, placeholder)
+			return placeholder
+		}
+	})
+	if repoErr != nil {
+		return "", repoErr
+	}
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("%w %q: unknown placeholder %s", ErrInvalidDirTemplate, template, strings.Join(unknown, ", "))
+	}
+
+	// The worktree must end up below the base directory, not in it or
+	// anywhere else
+	dir = filepath.Clean(filepath.FromSlash(dir))
+	if filepath.IsAbs(dir) || dir == "." || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w %q: %s is not below worktree.basedir", ErrInvalidDirTemplate, template, dir)
+	}
+	return dir, nil
+}
+
+// repoName returns the name of the repository, the directory of the main
+// worktree, or of a bare repository without its .git suffix.
+func (r *GitRepo) repoName() (string, error) {
+	dir, err := r.commonDir()
+	if err != nil {
+		return "", err
+	}
+	if !r.bare {
+		dir = filepath.Dir(dir)
+	}
+	name := strings.TrimSuffix(filepath.Base(dir), ".git")
+	if name == "" || name == ".bare" {
+		// project/.bare or project/.git holds the repository of project
+		name = filepath.Base(filepath.Dir(dir))
+	}
+	return name, nil
+}
@@ -0,0 +1,127 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Divergence is how far a branch has diverged from the branch it is compared
+// to, its upstream or else the default branch.
+type Divergence struct {
+	Base   string `json:"base"`
+	Ahead  int    `json:"ahead"`
+	Behind int    `json:"behind"`
+}
+
+// divergence compares branchname with its upstream, or with the default
+// branch if it has none. It returns nil if there is nothing to compare with.
+func (r *GitRepo) divergence(ctx context.Context, branchname string) (*Divergence, error) {
+	branch, err := r.repository.Reference(plumbing.NewBranchReferenceName(branchname), true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", branchname, err)
+	}
+
+	base, baseRef := r.comparisonBase(ctx, branchname)
+	if baseRef == "" {
+		return nil, nil
+	}
+	baseHash, err := r.repository.ResolveRevision(plumbing.Revision(baseRef))
+	if err != nil {
+		// An upstream that was deleted on the remote
+		return nil, nil
+	}
+
+	ahead, behind, err := r.aheadBehind(branch.Hash(), *baseHash)
+	if err != nil {
+		return nil, err
+	}
+	return &Divergence{Base: base, Ahead: ahead, Behind: behind}, nil
+}
+
+// comparisonBase returns the name to show and the ref of what branchname is
+// compared with: its upstream, else the default branch on the remote, else
+// the local default branch. Both are empty if branchname is that branch.
+func (r *GitRepo) comparisonBase(ctx context.Context, branchname string) (string, string) {
+	if upstream := r.upstreamBranch(ctx, branchname); upstream != "" {
+		return upstream, upstream
+	}
+	defaultBranch, err := r.defaultBranch()
+	if err != nil {
+		return "", ""
+	}
+	if r.branchExistsOnRemote(defaultBranch) {
+		remoteRef := plumbing.NewRemoteReferenceName(r.remote, defaultBranch)
+		return remoteRef.Short(), remoteRef.String()
+	}
+	if defaultBranch == branchname || !r.branchExistsLocally(defaultBranch) {
+		return "", ""
+	}
+	return defaultBranch, plumbing.NewBranchReferenceName(defaultBranch).String()
+}
+
+// aheadBehind counts the commits reachable from a but not b, and from b but
+// not a. Like git, it walks both histories newest first at the same time and
+// stops once everything left to walk is reachable from both, instead of
+// walking them to the root.
+func (r *GitRepo) aheadBehind(a, b plumbing.Hash) (int, int, error) {
+	const fromA, fromB = 1, 2
+
+	flags := make(map[plumbing.Hash]int)
+	var queue []*object.Commit // oldest first, so the newest is popped
+	push := func(hash plumbing.Hash, flag int) error {
+		if flags[hash]|flag == flags[hash] {
+			return nil
+		}
+		flags[hash] |= flag
+		commit, err := r.repository.CommitObject(hash)
+		if err != nil {
+			return err
+		}
+		i := sort.Search(len(queue), func(i int) bool {
+			return queue[i].Committer.When.After(commit.Committer.When)
+		})
+		queue = append(queue, nil)
+		copy(queue[i+1:], queue[i:])
+		queue[i] = commit
+		return nil
+	}
+	interesting := func() bool {
+		for _, commit := range queue {
+			if flags[commit.Hash] != fromA|fromB {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := push(a, fromA); err != nil {
+		return 0, 0, err
+	}
+	if err := push(b, fromB); err != nil {
+		return 0, 0, err
+	}
+	for interesting() {
+		commit := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for _, parent := range commit.ParentHashes {
+			if err := push(parent, flags[commit.Hash]); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+
+	var ahead, behind int
+	for _, flag := range flags {
+		switch flag {
+		case fromA:
+			ahead++
+		case fromB:
+			behind++
+		}
+	}
+	return ahead, behind, nil
+}
@@ -0,0 +1,86 @@
+package worktree
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testHistory builds commits in a new repository, each a minute after the
+// last, with the given parents.
+type testHistory struct {
+	t    *testing.T
+	repo *git.Repository
+	when time.Time
+}
+
+func newTestHistory(t *testing.T) *testHistory {
+	t.Helper()
+	repo, err := git.PlainInit(t.TempDir(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testHistory{t: t, repo: repo, when: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (h *testHistory) commit(parents ...plumbing.Hash) plumbing.Hash {
+	h.t.Helper()
+	w, err := h.repo.Worktree()
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	h.when = h.when.Add(time.Minute)
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: h.when}
+	hash, err := w.Commit("commit", &git.CommitOptions{
+		Author:            signature,
+		Parents:           parents,
+		AllowEmptyCommits: true,
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	return hash
+}
+
+func TestAheadBehind(t *testing.T) {
+	h := newTestHistory(t)
+	root := h.commit()
+	base := h.commit(root)
+	a1 := h.commit(base)
+	a2 := h.commit(a1)
+	b1 := h.commit(base)
+	merge := h.commit(a2, b1)
+	after := h.commit(merge)
+
+	repo := &GitRepo{repository: h.repo}
+	tests := []struct {
+		name   string
+		a, b   plumbing.Hash
+		ahead  int
+		behind int
+	}{
+		{"same commit", a2, a2, 0, 0},
+		{"ahead", a2, base, 2, 0},
+		{"behind", base, a2, 0, 2},
+		{"diverged", a2, b1, 2, 1},
+		{"from the root", a2, root, 3, 0},
+		{"merge", merge, a2, 2, 0},
+		{"merge of the other side", merge, b1, 3, 0},
+		{"after the merge", after, b1, 4, 0},
+		{"behind the merge", b1, after, 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ahead, behind, err := repo.aheadBehind(tt.a, tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ahead != tt.ahead || behind != tt.behind {
+				t.Errorf("aheadBehind = %d, %d, want %d, %d", ahead, behind, tt.ahead, tt.behind)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package worktree
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrNoEditor = errors.New("no editor configured, set worktree.editor, $VISUAL or $EDITOR")
+
+// directoryEditors open a directory as a project when given its path.
+var directoryEditors = map[string]bool{
+	"code":     true,
+	"cursor":   true,
+	"subl":     true,
+	"zed":      true,
+	"idea":     true,
+	"nvim":     true,
+	"vim":      true,
+	"hx":       true,
+	"emacs":    true,
+	"windsurf": true,
+}
+
+func (wm *WorktreeManager) openEditor(worktreePath string) error {
+	editor := wm.config.configValue("worktree.editor")
+	if editor == "" {
+		editor = os.Getenv("VISUAL")
+	}
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return ErrNoEditor
+	}
+
+	target := worktreePath
+	if directoryEditors[filepath.Base(fields[0])] {
+		// Open the worktree as a project so the editor's root is the worktree
+		target = "."
+	}
+	args := append(fields[1:], target)
+
+	if wm.config.DryRun {
+		wm.config.dryRunf("open %s in %s", worktreePath, fields[0])
+		return nil
+	}
+
+	cmd := wm.tracer.command(fields[0], args...)
+	if target == "." {
+		cmd.Dir = worktreePath
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	if wm.config.machineOutput() {
+		cmd.Stdout = os.Stderr
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
@@ -0,0 +1,53 @@
+package worktree
+
+import (
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Events lets programs using the package react to what CreateWorktree does,
+// as each step completes. Any of the funcs may be nil. They are not called in
+// dry-run mode.
+type Events struct {
+	// BranchCreated is called when a new local branch was created for the
+	// worktree, with the commit it points at.
+	BranchCreated func(branch, commit string)
+	// WorktreeCreated is called when the worktree was added, with its
+	// absolute path. branch is empty for a detached worktree.
+	WorktreeCreated func(branch, path string)
+	// FilesCopied is called when the untracked files were copied, with the
+	// worktree's absolute path and the copied files relative to it.
+	FilesCopied func(path string, files []string)
+}
+
+func (e Events) branchCreated(repo *GitRepo, branch string) {
+	if e.BranchCreated == nil {
+		return
+	}
+	var commit string
+	if ref, err := repo.repository.Reference(plumbing.NewBranchReferenceName(branch), true); err == nil {
+		commit = ref.Hash().String()
+	}
+	e.BranchCreated(branch, commit)
+}
+
+func (e Events) worktreeCreated(branch, path string) {
+	if e.WorktreeCreated != nil {
+		e.WorktreeCreated(branch, absPath(path))
+	}
+}
+
+func (e Events) filesCopied(path string, files []string) {
+	if e.FilesCopied != nil {
+		e.FilesCopied(absPath(path), files)
+	}
+}
+
+// absPath returns path made absolute, or as is if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,1055 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type FileCopier struct {
+	config *Config
+	// root is the directory the files are copied from, the repository root
+	// (the current directory) if empty
+	root string
+
+	// linkFailed is set when a symlink couldn't be created and the file was
+	// copied instead
+	linkFailed atomic.Bool
+	// hardlinked is set when node_modules was hardlinked
+	hardlinked atomic.Bool
+}
+
+func (fc *FileCopier) copyUntrackedFiles(ctx context.Context, branchname, worktreePath string) ([]string, error) {
+	pending, err := fc.copyEntries(branchname)
+	if err != nil {
+		return nil, err
+	}
+	if caseInsensitiveDir(worktreePath) {
+		pending = fc.dropCaseCollisions(pending)
+	}
+
+	link := fc.linkFiles()
+	if fc.config.DryRun {
+		action := "copy"
+		if link {
+			action = "link"
+		}
+		// What would be copied, for the planned result
+		var planned []string
+		for _, entry := range pending {
+			fc.config.dryRunf("%s %s to %s", action, entry.src, filepath.Join(worktreePath, entry.dest))
+			planned = append(planned, entry.dest)
+		}
+		return planned, nil
+	}
+
+	errs := fc.copyAll(ctx, pending, worktreePath, link)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if fc.linkFailed.Load() {
+		fc.config.warnf("Unable to create symlinks, copied the files instead. On Windows, this needs Developer Mode or administrator rights")
+	}
+	if fc.hardlinked.Load() {
+		fc.config.warnf("Hardlinked node_modules, its files share inodes with the repository, so editing one in place changes it in both")
+	}
+
+	var copied []string
+	for i, entry := range pending {
+		if errors.Is(errs[i], errDestUnchanged) {
+			continue
+		}
+		if errors.Is(errs[i], errDestExists) {
+			fc.config.warnf("Not overwriting %s, it differs from %s. Pass -overwrite-copies to replace it", filepath.Join(worktreePath, entry.dest), entry.src)
+			continue
+		}
+		if errs[i] != nil {
+			fc.config.warnf("Unable to copy file %s to %s: %v", entry.src, filepath.Join(worktreePath, entry.dest), errs[i])
+			continue
+		}
+		copied = append(copied, entry.dest)
+	}
+
+	return copied, nil
+}
+
+// copyEntries returns what is copied into a worktree for branchname: the
+// files matching the patterns, the .worktreefiles entries, and the
+// worktree.copymap entries, one per destination.
+func (fc *FileCopier) copyEntries(branchname string) ([]copyEntry, error) {
+	patterns, err := parseFilePatterns(fc.getUntrackedFilesPatterns(branchname))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if len(patterns) > 0 {
+		if files, err = fc.findFiles(patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	// Config.CopyPatterns replaces everything configured
+	var copies []copyEntry
+	if fc.config.CopyPatterns == nil {
+		files = append(files, fc.readManifest()...)
+		// worktree.copymap comes first so that its entries win over files
+		// copied to the same path
+		copies = fc.readCopyMap()
+	}
+	for _, file := range files {
+		copies = append(copies, copyEntry{src: file, dest: file})
+	}
+
+	root, err := fc.sourceRoot()
+	if err != nil {
+		return nil, err
+	}
+	var entries []copyEntry
+	seen := make(map[string]bool)
+	for _, entry := range copies {
+		if seen[entry.dest] {
+			continue
+		}
+		seen[entry.dest] = true
+		entries = append(entries, entry)
+		if entry.src != entry.dest {
+			continue
+		}
+		// A symlink is recreated, so what it points to in the repository
+		// has to be copied as well, unless a negated pattern excludes it
+		for _, target := range symlinkTargets(root, entry.src) {
+			info, err := os.Stat(filepath.Join(root, target))
+			if excluded(patterns, target, err == nil && info.IsDir()) {
+				fc.config.warnf("Not copying %s, which %s links to, as it is excluded, the link won't resolve in the worktree", target, entry.src)
+				break
+			}
+			if !seen[target] {
+				seen[target] = true
+				entries = append(entries, copyEntry{src: target, dest: target})
+			}
+		}
+	}
+	return entries, nil
+}
+
+// defaultCopyConcurrency is the number of files copied at the same time unless
+// worktree.copyconcurrency is set.
+const defaultCopyConcurrency = 4
+
+// copyConcurrency returns the number of files copied at the same time, from
+// worktree.copyconcurrency.
+func (fc *FileCopier) copyConcurrency() int {
+	value := fc.config.configValue("worktree.copyconcurrency")
+	if value == "" {
+		return defaultCopyConcurrency
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		fc.config.warnf("Invalid worktree.copyconcurrency %q, using %d", value, defaultCopyConcurrency)
+		return defaultCopyConcurrency
+	}
+	return n
+}
+
+// copyAll copies, or with link symlinks, the entries into the worktree with
+// up to copyConcurrency workers, and returns the error of each at the index
+// of its entry. Once ctx is done, the remaining entries are skipped.
+func (fc *FileCopier) copyAll(ctx context.Context, entries []copyEntry, worktreePath string, link bool) []error {
+	errs := make([]error, len(entries))
+	indexes := make(chan int)
+
+	var wg sync.WaitGroup
+	for range min(fc.copyConcurrency(), len(entries)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if errs[i] = ctx.Err(); errs[i] == nil {
+					errs[i] = fc.copyEntry(ctx, entries[i], worktreePath, link)
+				}
+			}
+		}()
+	}
+	for i := range entries {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	return errs
+}
+
+func (fc *FileCopier) copyEntry(ctx context.Context, entry copyEntry, worktreePath string, link bool) error {
+	destPath := filepath.Join(worktreePath, entry.dest)
+	if entry.src == entry.dest {
+		root, err := fc.sourceRoot()
+		if err != nil {
+			return err
+		}
+		if target, ok := worktreeLink(root, entry.src); ok {
+			return copySymlink(target, destPath, fc.config.Overwrite)
+		}
+	}
+	if !fc.config.Overwrite {
+		if err := checkDest(fc.source(entry.src), destPath); err != nil {
+			return err
+		}
+	}
+	if link {
+		if err := linkFile(fc.source(entry.src), destPath); err == nil {
+			return nil
+		}
+		fc.linkFailed.Store(true)
+	}
+	return fc.copyWithCOW(ctx, fc.source(entry.src), destPath)
+}
+
+var (
+	// errDestExists is returned for a file that exists in the worktree with
+	// different content, which is kept
+	errDestExists = errors.New("destination exists and differs")
+	// errDestUnchanged is returned for a file that exists in the worktree
+	// with the same content
+	errDestUnchanged = errors.New("destination exists and is the same")
+)
+
+// checkDest returns errDestExists or errDestUnchanged if the file dest
+// exists. Directories are merged into as before.
+func checkDest(src, dest string) error {
+	destInfo, err := os.Lstat(dest)
+	if err != nil || destInfo.IsDir() {
+		return nil
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil || srcInfo.IsDir() {
+		return nil
+	}
+	if same, err := sameContent(src, dest, srcInfo, destInfo); err == nil && same {
+		return errDestUnchanged
+	}
+	return errDestExists
+}
+
+// sameContent reports whether the files a and b have the same content.
+func sameContent(a, b string, aInfo, bInfo os.FileInfo) (bool, error) {
+	if bInfo.Mode()&os.ModeSymlink != 0 {
+		// A link made by -link, which is the same if it points at a
+		if target, err := os.Readlink(b); err == nil {
+			absA, _ := filepath.Abs(a)
+			return target == absA, nil
+		}
+	}
+	if aInfo.Size() != bInfo.Size() {
+		return false, nil
+	}
+
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 32*1024)
+	bufB := make([]byte, 32*1024)
+	for {
+		n, errA := io.ReadFull(fa, bufA)
+		_, errB := io.ReadFull(fb, bufB[:n])
+		if errB != nil || !bytes.Equal(bufA[:n], bufB[:n]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			return true, nil
+		}
+		if errA != nil {
+			return false, errA
+		}
+	}
+}
+
+// linkFile creates a symlink at dest to the absolute path of src, so that the
+// worktree shares the file with the repository.
+func linkFile(src, dest string) error {
+	absSrc, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(absSrc, dest)
+}
+
+// source returns the path of rel in the directory the files are copied from.
+func (fc *FileCopier) source(rel string) string {
+	return filepath.Join(fc.root, rel)
+}
+
+// sourceRoot returns the absolute path of the directory the files are copied
+// from.
+func (fc *FileCopier) sourceRoot() (string, error) {
+	if fc.root != "" {
+		return filepath.Abs(fc.root)
+	}
+	return os.Getwd()
+}
+
+// copyEntry copies src in the directory the files are copied from to dest in
+// the worktree, both relative to their root.
+type copyEntry struct {
+	src  string
+	dest string
+}
+
+// readCopyMap returns the entries of worktree.copymap. An entry is either a
+// path, copied to the same path in the worktree, or src:dest to copy src to a
+// different path. Entries whose source doesn't exist are skipped with a
+// warning.
+func (fc *FileCopier) readCopyMap() []copyEntry {
+	var entries []copyEntry
+	for _, value := range fc.config.configValues("worktree.copymap") {
+		src, dest, ok := strings.Cut(value, ":")
+		if !ok {
+			dest = src
+		}
+		src, srcOK := relativeToRoot(src)
+		dest, destOK := relativeToRoot(dest)
+		if !srcOK || !destOK {
+			fc.config.warnf("Ignoring worktree.copymap entry outside the repository: %s", value)
+			continue
+		}
+		if _, err := os.Lstat(fc.source(src)); err != nil {
+			fc.config.warnf("Skipping worktree.copymap entry %s: %v", value, err)
+			continue
+		}
+		entries = append(entries, copyEntry{src: src, dest: dest})
+	}
+	return entries
+}
+
+// relativeToRoot cleans a path given relative to the repository root, and
+// reports whether it stays inside the repository.
+func relativeToRoot(path string) (string, bool) {
+	path = filepath.Clean(strings.TrimPrefix(strings.TrimSpace(path), "/"))
+	return path, path != ".." && !strings.HasPrefix(path, "../")
+}
+
+const manifestFile = ".worktreefiles"
+
+// readManifest returns the files and directories listed in .worktreefiles at
+// the repository root. Entries that don't exist are skipped with a warning.
+func (fc *FileCopier) readManifest() []string {
+	data, err := os.ReadFile(fc.source(manifestFile))
+	if err != nil {
+		return nil
+	}
+
+	var entries []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entry, ok := relativeToRoot(line)
+		if !ok {
+			fc.config.warnf("Ignoring %s entry outside the repository: %s", manifestFile, line)
+			continue
+		}
+		if _, err := os.Lstat(fc.source(entry)); err != nil {
+			fc.config.warnf("Skipping %s entry %s: %v", manifestFile, line, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// getUntrackedFilesPatterns returns Config.CopyPatterns if set. Otherwise it
+// returns the configured patterns for branchname and those marked in
+// .gitattributes.
+func (fc *FileCopier) getUntrackedFilesPatterns(branchname string) []string {
+	if fc.config.CopyPatterns != nil {
+		if len(fc.config.CopyPatterns) == 0 {
+			return nil
+		}
+		return withDefaultPatterns(fc.config.CopyPatterns)
+	}
+	patterns := fc.configuredPatterns(branchname)
+	return append(patterns, fc.attributePatterns()...)
+}
+
+// configuredPatterns returns worktree.untrackedfiles, or the defaults, together
+// with the patterns of every worktree.<branch glob>.untrackedfiles whose glob
+// matches branchname.
+func (fc *FileCopier) configuredPatterns(branchname string) []string {
+	patterns := withDefaultPatterns(fc.config.configValues("worktree.untrackedfiles"))
+	return append(patterns, fc.branchUntrackedFilesPatterns(branchname)...)
+}
+
+// withDefaultPatterns returns patterns, after the defaults if there are only
+// negations, which subtract from the defaults.
+func withDefaultPatterns(patterns []string) []string {
+	if !slices.ContainsFunc(patterns, func(p string) bool { return !strings.HasPrefix(p, "!") }) {
+		patterns = append([]string{".env", ".envrc", ".env.local", ".mise.toml", ".tool-versions", "mise.toml"}, patterns...)
+	}
+	return patterns
+}
+
+// branchUntrackedFilesPatterns returns the patterns set in
+// worktree.<branch glob>.untrackedfiles for globs matching branchname. As in
+// path.Match, * does not match a slash, so staging/* matches staging/eu but
+// not staging/eu/1.
+func (fc *FileCopier) branchUntrackedFilesPatterns(branchname string) []string {
+	output, err := fc.config.tracer.command("git", "config", "--null", "--get-regexp", `^worktree\..+\.untrackedfiles$`).Output()
+	if err != nil {
+		return nil
+	}
+
+	var patterns []string
+	for _, entry := range strings.Split(string(output), "\x00") {
+		key, value, ok := strings.Cut(entry, "\n")
+		if !ok || value == "" {
+			continue
+		}
+		glob := strings.TrimSuffix(strings.TrimPrefix(key, "worktree."), ".untrackedfiles")
+		matched, err := path.Match(glob, branchname)
+		if err != nil {
+			fc.config.warnf("Ignoring invalid branch pattern in %s: %v", key, err)
+			continue
+		}
+		if matched {
+			patterns = append(patterns, value)
+		}
+	}
+	return patterns
+}
+
+// filePattern matches untracked files. Every pattern is translated to an
+// anchored regular expression, matched against the path relative to the
+// repository root if the pattern contains a slash and against the file name
+// otherwise:
+//
+//	a*b       * matches any characters except "/"
+//	a?b       ? matches a single character except "/"
+//	[a-z]     a character class, negated with [!a-z] or [^a-z]
+//	a/**/b    ** matches any number of directories as a whole path segment
+//	\*        a backslash matches the next character itself
+//	name/     a trailing slash matches a directory, copied as a whole
+//	!pattern  a leading "!" excludes what pattern matches
+//	re:expr   the regular expression expr
+//
+// So *.local.json matches app.local.json but not app.local.json.bak.
+//
+// Patterns containing any of \|()+^$ outside a character class are taken as
+// regular expressions as well if they compile, for backward compatibility.
+type filePattern struct {
+	re       *regexp.Regexp
+	fullPath bool
+	// dir patterns match directories, which are copied as a whole
+	dir bool
+	// negate patterns exclude what they match
+	negate bool
+}
+
+func parseFilePatterns(patterns []string) ([]filePattern, error) {
+	parsed := make([]filePattern, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := parseFilePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid untracked file pattern %q: %w", pattern, err)
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+func parseFilePattern(pattern string) (filePattern, error) {
+	p := filePattern{negate: strings.HasPrefix(pattern, "!")}
+	pattern = strings.TrimPrefix(pattern, "!")
+
+	if expr, ok := strings.CutPrefix(pattern, "re:"); ok {
+		return p.withRegexp(expr)
+	}
+	// A file name such as c++.txt is not a valid regular expression
+	if legacyRegexp(pattern) {
+		if legacy, err := p.withRegexp(pattern); err == nil {
+			return legacy, nil
+		}
+	}
+
+	// A trailing slash matches directories, as in .gitignore
+	p.dir = strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+	p.fullPath = strings.Contains(pattern, "/")
+	expr, err := globRegexp(strings.TrimPrefix(pattern, "/"))
+	if err != nil {
+		return p, err
+	}
+	p.re, err = regexp.Compile(expr)
+	return p, err
+}
+
+func (p filePattern) withRegexp(expr string) (filePattern, error) {
+	re, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return p, err
+	}
+	p.re = re
+	p.fullPath = strings.Contains(expr, "/")
+	return p, nil
+}
+
+// legacyRegexp reports whether a pattern uses regular expression syntax that
+// has no meaning in a glob.
+func legacyRegexp(pattern string) bool {
+	inClass := false
+	for _, r := range pattern {
+		switch {
+		case r == '[':
+			inClass = true
+		case r == ']':
+			inClass = false
+		case !inClass && strings.ContainsRune(`\|()+^$`, r):
+			return true
+		}
+	}
+	return false
+}
+
+// globRegexp translates a glob into an anchored regular expression.
+func globRegexp(glob string) (string, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	segments := strings.Split(glob, "/")
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		if segment == "**" {
+			if last {
+				b.WriteString(".*")
+			} else {
+				b.WriteString("(?:[^/]+/)*")
+			}
+			continue
+		}
+		if err := globSegmentRegexp(&b, segment); err != nil {
+			return "", err
+		}
+		if !last {
+			b.WriteString("/")
+		}
+	}
+	b.WriteString("$")
+	return b.String(), nil
+}
+
+func globSegmentRegexp(b *strings.Builder, segment string) error {
+	for i := 0; i < len(segment); i++ {
+		switch c := segment[i]; c {
+		case '*':
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '\\':
+			if i+1 == len(segment) {
+				return filepath.ErrBadPattern
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(segment[i : i+1]))
+		case '[':
+			end := strings.IndexByte(segment[i+1:], ']')
+			if end < 1 {
+				return filepath.ErrBadPattern
+			}
+			class := segment[i+1 : i+1+end]
+			if negated, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + negated
+			}
+			if class == "" || class == "^" {
+				return filepath.ErrBadPattern
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return nil
+}
+
+func (p filePattern) match(path string, isDir bool) bool {
+	if p.dir != isDir {
+		return false
+	}
+	path = filepath.ToSlash(path)
+	if !p.fullPath {
+		path = filepath.Base(path)
+	}
+	return p.re.MatchString(path)
+}
+
+// matchAny reports whether path matches one of the patterns and none of the
+// negated ones, regardless of their order. A negated directory pattern also
+// excludes everything below the directory.
+func matchAny(patterns []filePattern, path string, isDir bool) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if !pattern.negate && pattern.match(path, isDir) {
+			matched = true
+			break
+		}
+	}
+	return matched && !excluded(patterns, path, isDir)
+}
+
+// excluded reports whether one of the negated patterns matches path, or, for
+// a negated directory pattern, a directory above it.
+func excluded(patterns []filePattern, path string, isDir bool) bool {
+	for _, pattern := range patterns {
+		if !pattern.negate {
+			continue
+		}
+		if pattern.match(path, isDir) {
+			return true
+		}
+		if pattern.dir {
+			for dir := filepath.Dir(path); dir != "."; dir = filepath.Dir(dir) {
+				if pattern.match(dir, true) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (fc *FileCopier) findFiles(patterns []filePattern) ([]string, error) {
+	if fd := fc.fdCommand(); fd != "" {
+		return fc.findFilesWithFd(fd, patterns)
+	}
+	return fc.findFilesWithWalk(patterns)
+}
+
+func (fc *FileCopier) getExcludedDirs() []string {
+	if dirs := fc.config.configValues("worktree.excludedirs"); len(dirs) > 0 {
+		return dirs
+	}
+	return []string{"node_modules", ".git", "vendor"}
+}
+
+// fdCommand returns the fd binary to list files with: worktree.fdpath, or fd,
+// or fdfind as Debian and Ubuntu name it. It returns "" if there is none.
+func (fc *FileCopier) fdCommand() string {
+	if fdPath := fc.config.configValue("worktree.fdpath"); fdPath != "" {
+		if path, err := exec.LookPath(expandHome(fdPath)); err == nil {
+			return path
+		}
+		fc.config.warnf("worktree.fdpath %s not found, looking for fd instead", fdPath)
+	}
+	for _, name := range []string{"fd", "fdfind"} {
+		if hasCommand(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (fc *FileCopier) findFilesWithFd(fd string, patterns []filePattern) ([]string, error) {
+	// fd lists the candidates, the patterns are applied here so that both
+	// search strategies match the same way
+	args := []string{"-u", "-t", "f", "-t", "l"}
+	if slices.ContainsFunc(patterns, func(p filePattern) bool { return p.dir }) {
+		args = append(args, "-t", "d")
+	}
+	for _, dir := range fc.getExcludedDirs() {
+		args = append(args, "-E", dir)
+	}
+	root, err := fc.sourceRoot()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, "--search-path", root)
+	cmd := fc.config.tracer.command(fd, args...)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	nested := fc.nestedRepos(root)
+	files := []string{}
+	var dirs []string
+	for _, file := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if file == "" {
+			continue
+		}
+		isDir := strings.HasSuffix(file, string(filepath.Separator))
+		file, err := repoRelativePath(root, file)
+		if err != nil {
+			return nil, err
+		}
+		if !isDir {
+			if info, err := os.Lstat(filepath.Join(root, file)); err == nil {
+				isDir = info.IsDir()
+			}
+		}
+		if !matchAny(patterns, file, isDir) || nested.contains(file) {
+			continue
+		}
+		if isDir {
+			if nested.isRepo(file) {
+				continue
+			}
+			dirs = append(dirs, file)
+		}
+		files = append(files, file)
+	}
+
+	// fd lists the contents of matched directories too, which are copied
+	// with the directory
+	return slices.DeleteFunc(files, func(file string) bool {
+		return slices.ContainsFunc(dirs, func(dir string) bool {
+			return strings.HasPrefix(file, dir+string(filepath.Separator))
+		})
+	}), nil
+}
+
+// nestedRepos reports whether files lie in a repository nested below root,
+// such as a submodule, whose files are not copied. Directories are looked up
+// once.
+type nestedRepos struct {
+	root     string
+	disabled bool
+	dirs     map[string]bool
+}
+
+// nestedRepos looks for nested repositories below root, unless
+// worktree.includesubmodules is set to copy their files as well.
+func (fc *FileCopier) nestedRepos(root string) *nestedRepos {
+	return &nestedRepos{
+		root:     root,
+		disabled: fc.config.configBool("worktree.includesubmodules"),
+		dirs:     make(map[string]bool),
+	}
+}
+
+// contains reports whether the file at rel, relative to the root, is in a
+// nested repository.
+func (n *nestedRepos) contains(rel string) bool {
+	dir := filepath.Dir(rel)
+	if n.disabled || dir == "." {
+		return false
+	}
+	if nested, ok := n.dirs[dir]; ok {
+		return nested
+	}
+	nested := n.isRepo(dir) || n.contains(dir)
+	n.dirs[dir] = nested
+	return nested
+}
+
+// isRepo reports whether dir, relative to the root, is the top of a nested
+// repository, which has its own .git file or directory.
+func (n *nestedRepos) isRepo(dir string) bool {
+	if n.disabled {
+		return false
+	}
+	_, err := os.Lstat(filepath.Join(n.root, dir, ".git"))
+	return err == nil
+}
+
+// repoRelativePath returns file, as printed by fd, relative to the repository
+// root, so that it can be joined onto the worktree path.
+func repoRelativePath(root, file string) (string, error) {
+	if filepath.IsAbs(file) {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve %s relative to the repository: %w", file, err)
+		}
+		file = rel
+	}
+	return filepath.Clean(file), nil
+}
+
+func (fc *FileCopier) findFilesWithWalk(patterns []filePattern) ([]string, error) {
+	var files []string
+
+	excluded := make(map[string]bool)
+	for _, dir := range fc.getExcludedDirs() {
+		excluded[dir] = true
+	}
+
+	root, err := fc.sourceRoot()
+	if err != nil {
+		return nil, err
+	}
+
+	nested := fc.nestedRepos(root)
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() && path != root {
+			if excluded[info.Name()] || nested.isRepo(rel) {
+				return filepath.SkipDir
+			}
+			if matchAny(patterns, rel, true) {
+				// Copied as a whole
+				files = append(files, rel)
+				return filepath.SkipDir
+			}
+		}
+		if !info.IsDir() && matchAny(patterns, rel, false) {
+			files = append(files, rel)
+		}
+
+		return nil
+	})
+
+	return files, err
+}
+
+func (fc *FileCopier) copyWithCOW(ctx context.Context, src, dest string) error {
+	destDir := filepath.Dir(dest)
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	// Copy the contents of directories so an existing destination directory
+	// is merged into instead of getting the source nested inside it
+	cpSrc := src
+	if info, err := os.Lstat(src); err == nil && info.IsDir() {
+		cpSrc = src + string(filepath.Separator) + "."
+	}
+
+	if fc.hardlinkModules(src) {
+		// Faster still than a reflink copy, but the files share their inodes
+		// with the repository
+		if err := fc.config.tracer.commandContext(ctx, "cp", "-al", cpSrc, dest).Run(); err == nil {
+			fc.hardlinked.Store(true)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	for _, strategy := range cowStrategies() {
+		args := append(strategy, cpSrc, dest)
+		cmd := fc.config.tracer.commandContext(ctx, "cp", args...)
+		if err := cmd.Run(); err == nil {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+
+	// Regular copy, done natively so progress can be reported and file modes
+	// and symlinks are preserved the same way on every platform
+	if err := fc.copyTree(src, dest); err != nil {
+		return fmt.Errorf("failed to copy %s to %s: %w", src, dest, err)
+	}
+	return nil
+}
+
+// linkFiles reports whether the files are symlinked instead of copied.
+func (fc *FileCopier) linkFiles() bool {
+	return fc.config.Link || fc.config.configBool("worktree.linkfiles")
+}
+
+// hardlinkModules reports whether src is hardlinked into the worktree, as
+// files in node_modules are with Config.HardlinkDeps.
+func (fc *FileCopier) hardlinkModules(src string) bool {
+	return fc.config.HardlinkDeps && inNodeModules(src) && hasCommand("cp")
+}
+
+// nodeModulesStrategy returns how a node_modules directory among entries
+// would be put into a worktree, choosing like copyEntry does, or "skipped" if
+// there is none.
+func (fc *FileCopier) nodeModulesStrategy(entries []copyEntry) string {
+	i := slices.IndexFunc(entries, func(entry copyEntry) bool { return inNodeModules(entry.src) })
+	switch {
+	case i < 0:
+		return "skipped"
+	case fc.linkFiles():
+		return "linked"
+	case fc.hardlinkModules(fc.source(entries[i].src)):
+		return "hardlinked"
+	case len(cowStrategies()) > 0:
+		return "copied, copy-on-write where supported"
+	default:
+		return "copied"
+	}
+}
+
+// inNodeModules reports whether path is or lies in a node_modules directory,
+// whose dependencies are not edited in place.
+func inNodeModules(path string) bool {
+	return slices.Contains(strings.Split(filepath.ToSlash(path), "/"), "node_modules")
+}
+
+// cowStrategies returns the cp flags that copy-on-write on this platform.
+// Platforms without such a cp, including Windows, use the native copy only.
+func cowStrategies() [][]string {
+	if !hasCommand("cp") {
+		return nil
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"-Rc"}} // macOS clonefile
+	case "linux":
+		return [][]string{{"-R", "--reflink"}} // GNU reflink
+	default:
+		return nil
+	}
+}
+
+func (fc *FileCopier) copyTree(src, dest string) error {
+	total, err := treeSize(src)
+	if err != nil {
+		return err
+	}
+	progress := &copyProgress{name: src, total: total, last: time.Now(), config: fc.config}
+
+	err = filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chmod(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			// Recreate the link itself rather than copying what it points to
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm(), progress)
+		}
+		return nil
+	})
+
+	progress.finish()
+	return err
+}
+
+func copyFile(src, dest string, perm os.FileMode, progress *copyProgress) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(io.MultiWriter(out, progress), in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// OpenFile applies the umask, so set the source mode explicitly
+	return os.Chmod(dest, perm)
+}
+
+func treeSize(root string) (int64, error) {
+	var total int64
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// copyProgress reports the percentage of bytes copied to Config.Logger. Updates are
+// throttled, so copies that finish quickly never print anything, and nothing
+// is printed in quiet mode.
+type copyProgress struct {
+	name    string
+	total   int64
+	copied  int64
+	last    time.Time
+	printed bool
+	config  *Config
+}
+
+const progressInterval = 500 * time.Millisecond
+
+func (p *copyProgress) Write(b []byte) (int, error) {
+	p.copied += int64(len(b))
+	if !p.config.Quiet && time.Since(p.last) >= progressInterval {
+		p.report()
+	}
+	return len(b), nil
+}
+
+func (p *copyProgress) report() {
+	percent := 100
+	if p.total > 0 {
+		percent = int(p.copied * 100 / p.total)
+	}
+	p.config.log(Yellow, fmt.Sprintf("copying %s: %d%%", p.name, percent))
+	p.last = time.Now()
+	p.printed = true
+}
+
+func (p *copyProgress) finish() {
+	if p.printed {
+		p.report()
+	}
+}
+
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
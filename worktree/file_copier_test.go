@@ -0,0 +1,317 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGlobRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*.env", ".env", true},
+		{"*.env", "app.env", true},
+		{"*.env", "app.env.bak", false},
+		{"*.env", "config/app.env", false},
+		{"?.txt", "a.txt", true},
+		{"?.txt", "ab.txt", false},
+		{"[a-c].txt", "b.txt", true},
+		{"[a-c].txt", "d.txt", false},
+		{"[!a-c].txt", "d.txt", true},
+		{"[!a-c].txt", "a.txt", false},
+		{"config/**/local.json", "config/local.json", true},
+		{"config/**/local.json", "config/a/b/local.json", true},
+		{"config/**/local.json", "other/local.json", false},
+		{"config/**", "config/a/b", true},
+		{`\*.txt`, "*.txt", true},
+		{`\*.txt`, "a.txt", false},
+		{"c++.txt", "c++.txt", true},
+		{"a.b", "axb", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob+" "+tt.path, func(t *testing.T) {
+			expr, err := globRegexp(tt.glob)
+			if err != nil {
+				t.Fatalf("globRegexp(%q) = %v", tt.glob, err)
+			}
+			if got := regexp.MustCompile(expr).MatchString(tt.path); got != tt.match {
+				t.Errorf("globRegexp(%q) = %q, matching %q = %v, want %v", tt.glob, expr, tt.path, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestGlobRegexpInvalid(t *testing.T) {
+	for _, glob := range []string{`a\`, "[", "[abc", "[]", "[!]"} {
+		t.Run(glob, func(t *testing.T) {
+			if _, err := globRegexp(glob); !errors.Is(err, filepath.ErrBadPattern) {
+				t.Errorf("globRegexp(%q) = %v, want ErrBadPattern", glob, err)
+			}
+		})
+	}
+}
+
+func TestParseFilePattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		dir      bool
+		fullPath bool
+		negate   bool
+		match    []string
+		noMatch  []string
+	}{
+		{pattern: ".env", match: []string{".env"}, noMatch: []string{"a.env", ".envrc"}},
+		{pattern: "*.local.json", match: []string{"app.local.json"}, noMatch: []string{"app.local.json.bak"}},
+		{pattern: "config/*.json", fullPath: true, match: []string{"config/app.json"}, noMatch: []string{"app.json", "other/config/app.json"}},
+		{pattern: "/config/*.json", fullPath: true, match: []string{"config/app.json"}},
+		{pattern: "node_modules/", dir: true, match: []string{"node_modules"}},
+		{pattern: "!secret.env", negate: true, match: []string{"secret.env"}},
+		{pattern: "re:.*\\.env", match: []string{".env", "app.env"}, noMatch: []string{"app.envrc"}},
+		{pattern: "re:config/.*", fullPath: true, match: []string{"config/a"}},
+		{pattern: `(foo|bar)\.txt`, match: []string{"foo.txt", "bar.txt"}, noMatch: []string{"baz.txt"}},
+		{pattern: "c++.txt", match: []string{"c++.txt"}, noMatch: []string{"cc.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := parseFilePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("parseFilePattern(%q) = %v", tt.pattern, err)
+			}
+			if p.dir != tt.dir || p.fullPath != tt.fullPath || p.negate != tt.negate {
+				t.Errorf("parseFilePattern(%q) = dir %v, fullPath %v, negate %v, want %v, %v, %v",
+					tt.pattern, p.dir, p.fullPath, p.negate, tt.dir, tt.fullPath, tt.negate)
+			}
+			for _, path := range tt.match {
+				if !p.match(path, tt.dir) {
+					t.Errorf("%q doesn't match %q", tt.pattern, path)
+				}
+			}
+			for _, path := range tt.noMatch {
+				if p.match(path, tt.dir) {
+					t.Errorf("%q matches %q", tt.pattern, path)
+				}
+			}
+		})
+	}
+}
+
+func TestParseFilePatternInvalid(t *testing.T) {
+	for _, pattern := range []string{"re:(", "[abc"} {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := parseFilePattern(pattern); err == nil {
+				t.Errorf("parseFilePattern(%q) = nil, want an error", pattern)
+			}
+		})
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"no patterns", nil, ".env", false, false},
+		{"match", []string{".env", ".envrc"}, ".envrc", false, true},
+		{"file name in a directory", []string{".env"}, "app/.env", false, true},
+		{"no match", []string{".env"}, ".env.example", false, false},
+		{"negated", []string{"*.env", "!secret.env"}, "secret.env", false, false},
+		{"negated first", []string{"!secret.env", "*.env"}, "secret.env", false, false},
+		{"negated other", []string{"*.env", "!secret.env"}, "app.env", false, true},
+		{"only negated", []string{"!secret.env"}, "app.env", false, false},
+		{"directory", []string{"node_modules/"}, "node_modules", true, true},
+		{"directory pattern and file", []string{"node_modules/"}, "node_modules", false, false},
+		{"file pattern and directory", []string{".env"}, ".env", true, false},
+		{"below negated directory", []string{"*.env", "!fixtures/"}, "fixtures/a/test.env", false, false},
+		{"beside negated directory", []string{"*.env", "!fixtures/"}, "app/test.env", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns, err := parseFilePatterns(tt.patterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := matchAny(patterns, tt.path, tt.isDir); got != tt.want {
+				t.Errorf("matchAny(%q, %q, %v) = %v, want %v", tt.patterns, tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestRepo creates an empty repository with isolateGitConfig and changes
+// into it.
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	isolateGitConfig(t)
+	dir := t.TempDir()
+	if output, err := exec.Command("git", "init", "-q", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v: %s", err, output)
+	}
+	t.Chdir(dir)
+	return dir
+}
+
+// writeFiles creates the files below dir, with the path as content.
+func writeFiles(t *testing.T, dir string, files ...string) {
+	t.Helper()
+	for _, file := range files {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestCopyEntriesExcludedSymlinkTarget(t *testing.T) {
+	dir := newTestRepo(t)
+	writeFiles(t, dir, ".env.dev", ".env.prod", ".envrc")
+	if err := os.Symlink(".env.dev", filepath.Join(dir, ".env")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".env.prod", filepath.Join(dir, ".envrc.link")); err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	fc := &FileCopier{config: &Config{
+		CopyPatterns: []string{".env", ".envrc*", "!.env.dev"},
+		Logger:       log.New(&output, "", 0),
+	}}
+	entries, err := fc.copyEntries("feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dests []string
+	for _, entry := range entries {
+		dests = append(dests, entry.dest)
+	}
+	slices.Sort(dests)
+	if want := []string{".env", ".env.prod", ".envrc", ".envrc.link"}; !slices.Equal(dests, want) {
+		t.Errorf("copyEntries = %q, want %q", dests, want)
+	}
+	if !strings.Contains(output.String(), "Not copying .env.dev") {
+		t.Errorf("no warning about the excluded target .env.dev:\n%s", output.String())
+	}
+}
+
+func TestCopyUntrackedFilesConcurrent(t *testing.T) {
+	dir := newTestRepo(t)
+	run(t, dir, "git", "config", "worktree.copyconcurrency", "8")
+	modes := []os.FileMode{0600, 0644, 0755}
+	want := make(map[string]os.FileMode)
+	for i := range 50 {
+		file := filepath.Join(fmt.Sprintf("dir%d", i%5), fmt.Sprintf("sub%d", i%3), fmt.Sprintf("file%d.env", i))
+		writeFiles(t, dir, file)
+		mode := modes[i%len(modes)]
+		if err := os.Chmod(filepath.Join(dir, file), mode); err != nil {
+			t.Fatal(err)
+		}
+		want[file] = mode
+	}
+
+	worktreePath := t.TempDir()
+	fc := &FileCopier{config: &Config{CopyPatterns: []string{"*.env"}, Quiet: true, Logger: log.New(io.Discard, "", 0)}}
+	copied, err := fc.copyUntrackedFiles(context.Background(), "feature", worktreePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copied) != len(want) {
+		t.Errorf("copied %d files, want %d: %q", len(copied), len(want), copied)
+	}
+	for file, mode := range want {
+		path := filepath.Join(worktreePath, file)
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("%s not copied: %v", file, err)
+			continue
+		}
+		if string(content) != file {
+			t.Errorf("%s = %q, want %q", file, content, file)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if runtime.GOOS != "windows" && info.Mode().Perm() != mode {
+			t.Errorf("%s mode = %v, want %v", file, info.Mode().Perm(), mode)
+		}
+	}
+}
+
+// fakeFd is an fd for findFilesWithFd that lists the files and symlinks
+// below --search-path with find, as fd -u -t f -t l -E .git would.
+const fakeFd = `#!/bin/sh
+while [ "$1" != --search-path ]; do shift; done
+find "$2" -name .git -prune -o \( -type f -o -type l \) -print
+`
+
+func TestCopyUntrackedFilesNestedRepos(t *testing.T) {
+	tests := []struct {
+		name              string
+		includeSubmodules bool
+		fd                bool
+		want              []string
+	}{
+		{name: "walk", want: []string{".env"}},
+		{name: "fd", fd: true, want: []string{".env"}},
+		{name: "walk including submodules", includeSubmodules: true, want: []string{".env", "module/.env", "nested/.env"}},
+		{name: "fd including submodules", fd: true, includeSubmodules: true, want: []string{".env", "module/.env", "nested/.env"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fd && runtime.GOOS == "windows" {
+				t.Skip("the fake fd is a shell script")
+			}
+			module := newTestRepo(t)
+			run(t, module, "git", "commit", "-q", "--allow-empty", "-m", "initial")
+			dir := newTestRepo(t)
+			run(t, dir, "git", "-c", "protocol.file.allow=always", "submodule", "add", "-q", module, "module")
+			run(t, dir, "git", "init", "-q", "nested")
+			writeFiles(t, dir, ".env", "module/.env", "nested/.env")
+			run(t, dir, "git", "config", "worktree.includesubmodules", fmt.Sprint(tt.includeSubmodules))
+			if tt.fd {
+				fd := filepath.Join(t.TempDir(), "fd")
+				if err := os.WriteFile(fd, []byte(fakeFd), 0755); err != nil {
+					t.Fatal(err)
+				}
+				run(t, dir, "git", "config", "worktree.fdpath", fd)
+			}
+
+			worktreePath := t.TempDir()
+			fc := &FileCopier{config: &Config{CopyPatterns: []string{".env"}, Quiet: true, Logger: log.New(io.Discard, "", 0)}}
+			copied, err := fc.copyUntrackedFiles(context.Background(), "feature", worktreePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(copied)
+			if !slices.Equal(copied, tt.want) {
+				t.Errorf("copyUntrackedFiles = %q, want %q", copied, tt.want)
+			}
+			for _, file := range []string{"module/.env", "nested/.env"} {
+				_, err := os.Stat(filepath.Join(worktreePath, file))
+				if copied := err == nil; copied != slices.Contains(tt.want, file) {
+					t.Errorf("%s copied = %v", file, copied)
+				}
+			}
+		})
+	}
+}
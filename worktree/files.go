@@ -0,0 +1,48 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// ListFiles prints the untracked files that would be copied into a new
+// worktree for branchname, without creating anything. branchname may be empty,
+// it only matters for branch-scoped patterns. Files copied to a different path
+// are printed as src -> dest.
+func (wm *WorktreeManager) ListFiles(ctx context.Context, branchname string) error {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return err
+	}
+	wm.repo = repo
+
+	if branchname != "" {
+		branchname = wm.applyBranchPrefix(branchname)
+	}
+
+	var copySource string
+	if wm.config.CopyFrom != "" {
+		copySource, err = wm.resolveCopySource(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	fileCopier := &FileCopier{config: wm.config, root: copySource}
+	entries, err := fileCopier.copyEntries(branchname)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.src == entry.dest {
+			fmt.Println(entry.src)
+		} else {
+			fmt.Printf("%s -> %s\n", entry.src, entry.dest)
+		}
+	}
+	// On stderr, so that the list stays a list of files
+	fmt.Fprintf(os.Stderr, "node_modules: %s\n", fileCopier.nodeModulesStrategy(entries))
+	return nil
+}
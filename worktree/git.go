@@ -0,0 +1,869 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+type GitRepo struct {
+	root       string
+	bare       bool
+	remote     string
+	repository *git.Repository
+	config     *Config
+	// hasRemote is false in a repository without the remote, such as a new
+	// local one, where there is nothing to pull or fetch
+	hasRemote bool
+
+	// auth caches the resolved auth method for the remote, see getAuth
+	auth         transport.AuthMethod
+	authResolved bool
+}
+
+func (wm *WorktreeManager) initGitRepo() (*GitRepo, error) {
+	if err := wm.config.loadConfigFile(); err != nil {
+		return nil, err
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	repo, err := git.PlainOpenWithOptions(cwd, &git.PlainOpenOptions{
+		DetectDotGit:          true,
+		EnableDotGitCommonDir: true,
+	})
+	if err != nil {
+		// Bare repositories have no .git directory to detect, so ask git
+		// where the repository is
+		cmd := wm.tracer.command("git", "rev-parse", "--absolute-git-dir")
+		output, gitErr := cmd.Output()
+		if gitErr != nil {
+			return nil, ErrNotInGitRepo
+		}
+		repo, err = git.PlainOpen(strings.TrimSpace(string(output)))
+		if err != nil {
+			return nil, ErrNotInGitRepo
+		}
+	}
+
+	var root string
+	bare := wm.isBareRepository()
+	if bare {
+		// A bare repository has no working tree to change into, so stay in
+		// the current directory and use the repository itself as the root
+		cmd := wm.tracer.command("git", "rev-parse", "--absolute-git-dir")
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to locate bare repository: %w", err)
+		}
+		root = strings.TrimSpace(string(output))
+	} else {
+		workTree, err := repo.Worktree()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get worktree: %w", err)
+		}
+
+		root = workTree.Filesystem.Root()
+		if err := os.Chdir(root); err != nil {
+			return nil, fmt.Errorf("failed to change to git root directory: %w", err)
+		}
+	}
+
+	remote := wm.config.configValue("worktree.remote")
+	if remote == "" {
+		remote = "origin"
+	}
+
+	_, err = repo.Remote(remote)
+	return &GitRepo{
+		root:       root,
+		bare:       bare,
+		remote:     remote,
+		repository: repo,
+		config:     wm.config,
+		hasRemote:  err == nil,
+	}, nil
+}
+
+// isBareRepository asks git rather than go-git, which treats a bare
+// repository referenced from a .git file as having a working tree.
+func (wm *WorktreeManager) isBareRepository() bool {
+	cmd := wm.tracer.command("git", "rev-parse", "--is-bare-repository")
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// gitConfigValue returns the value of a git config key, or "" if it is unset.
+func (c *Config) gitConfigValue(key string) string {
+	cmd := c.tracer.command("git", "config", "--get", key)
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// gitConfigBool returns a boolean git config key, which is false if it is
+// unset or not a boolean.
+func (c *Config) gitConfigBool(key string) bool {
+	cmd := c.tracer.command("git", "config", "--type=bool", "--get", key)
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// gitConfigValues returns all values of a multi-valued git config key.
+func (c *Config) gitConfigValues(key string) []string {
+	cmd := c.tracer.command("git", "config", "--get-all", key)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil
+	}
+
+	var values []string
+	for _, value := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (r *GitRepo) worktreeBaseDir() (string, error) {
+	baseDir := os.Getenv("WORKTREE_BASEDIR")
+	if baseDir == "" {
+		baseDir = r.config.configValue("worktree.basedir")
+	}
+	if baseDir == "" {
+		if r.bare {
+			// Keep worktrees next to the bare repository, e.g. project/main
+			// for project/.bare
+			return filepath.Dir(r.root), nil
+		}
+		return "..", nil
+	}
+
+	baseDir = expandHome(baseDir)
+	if !filepath.IsAbs(baseDir) {
+		baseDir = filepath.Join(r.root, baseDir)
+	}
+	return baseDir, nil
+}
+
+func (r *GitRepo) pull(ctx context.Context) error {
+	w, err := r.repository.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get worktree: %w", err)
+	}
+
+	auth, err := r.getAuth()
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return fmt.Errorf("%w: %s", ErrRemoteNotFound, r.remote)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get authentication: %w", err)
+	}
+
+	caBundle, proxy, err := r.httpOptions()
+	if err != nil {
+		return err
+	}
+
+	err = w.PullContext(ctx, &git.PullOptions{
+		RemoteName:   r.remote,
+		Progress:     r.getProgressWriter(),
+		Auth:         auth,
+		CABundle:     caBundle,
+		ProxyOptions: proxy,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return r.remoteError(err)
+	}
+
+	return nil
+}
+
+// isTransientError reports whether err is a network error that may go away
+// when retried, such as a reset connection or a timeout. Authentication and
+// configuration errors are not. Only the error types are looked at, not their
+// messages.
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, ErrAuthFailed) || errors.Is(err, ErrNoUpstream) || errors.Is(err, ErrRemoteNotFound) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.ETIMEDOUT, syscall.EPIPE, syscall.ENETUNREACH, syscall.EHOSTUNREACH} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteError returns pullError(err), and forgets the cached auth method if
+// it was rejected, so that the next attempt resolves it again.
+func (r *GitRepo) remoteError(err error) error {
+	err = pullError(err)
+	if errors.Is(err, ErrAuthFailed) {
+		r.auth, r.authResolved = nil, false
+	}
+	return err
+}
+
+// pullError maps the errors go-git returns from a pull to the package's
+// sentinel errors so callers can check them with errors.Is.
+func pullError(err error) error {
+	switch {
+	case errors.Is(err, plumbing.ErrReferenceNotFound):
+		return fmt.Errorf("%w: %v", ErrNoUpstream, err)
+	case errors.Is(err, git.ErrRemoteNotFound):
+		return fmt.Errorf("%w: %v", ErrRemoteNotFound, err)
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrRepositoryNotFound):
+		return fmt.Errorf("%w: %v", ErrAuthFailed, err)
+	default:
+		return fmt.Errorf("failed to pull: %w", err)
+	}
+}
+
+// resolveWorktreePath returns where the worktree for branchname lives or
+// should be created, and whether it already exists. Branch names map to
+// directories by replacing "/" with "_". If that directory is already a
+// worktree for a different branch, for example feature/foo and feature_foo,
+// a short hash of the branch name is appended. git's worktree list is the
+// record of which directory belongs to which branch. A branch checked out in
+// the main worktree can't get one of its own, it returns
+// ErrBranchInMainWorktree.
+func (r *GitRepo) resolveWorktreePath(ctx context.Context, baseDir, branchname string) (string, bool, error) {
+	worktrees, err := r.listWorktrees(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	for i, wt := range worktrees {
+		if wt.Branch != branchname {
+			continue
+		}
+		// The first entry is the main worktree
+		if i == 0 {
+			return "", false, fmt.Errorf("%w: %s is checked out in %s, switch it to another branch there, or pass -detach -from %s for a worktree at its commit without a branch", ErrBranchInMainWorktree, branchname, wt.Path, branchname)
+		}
+		// git refuses to check the branch out again while the stale entry
+		// exists
+		if _, err := os.Stat(wt.Path); wt.Prunable || os.IsNotExist(err) {
+			return "", false, fmt.Errorf("%w: %s is checked out in %s, run worktree prune to clean it up", ErrStaleWorktree, branchname, wt.Path)
+		}
+		return wt.Path, true, nil
+	}
+
+	dirname, err := r.worktreeDir(branchname)
+	if err != nil {
+		return "", false, err
+	}
+	candidates := []string{dirname, dirname + "-" + branchHash(branchname)}
+	var conflict error
+	for _, candidate := range candidates {
+		worktreePath := filepath.Join(baseDir, candidate)
+		conflict = r.checkPathFree(worktrees, worktreePath, branchname)
+		if conflict == nil {
+			return worktreePath, false, nil
+		}
+		if !errors.Is(conflict, errPathIsWorktree) {
+			break
+		}
+	}
+	return "", false, conflict
+}
+
+// resolveDetachedPath returns where the detached worktree named name lives or
+// should be created, and whether it already exists.
+func (r *GitRepo) resolveDetachedPath(ctx context.Context, baseDir, name string) (string, bool, error) {
+	worktrees, err := r.listWorktrees(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	dirname, err := r.worktreeDir(name)
+	if err != nil {
+		return "", false, err
+	}
+	worktreePath := filepath.Join(baseDir, dirname)
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	for _, wt := range worktrees {
+		if wt.Detached && resolvePath(wt.Path) == resolvePath(absPath) {
+			return wt.Path, true, nil
+		}
+	}
+	if err := r.checkPathFree(worktrees, worktreePath, name); err != nil {
+		return "", false, err
+	}
+	return worktreePath, false, nil
+}
+
+var errPathIsWorktree = fmt.Errorf("%w: path is another branch's worktree", ErrWorktreePathExists)
+
+func (r *GitRepo) checkPathFree(worktrees []WorktreeInfo, worktreePath, branchname string) error {
+	if _, err := os.Lstat(worktreePath); os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to check worktree path: %w", err)
+	}
+
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	target := resolvePath(absPath)
+
+	for _, wt := range worktrees {
+		wtPath := resolvePath(wt.Path)
+		// On a case-insensitive file system, Feature is the worktree of
+		// feature
+		collision := caseCollision(wtPath, target) && sameFile(wtPath, target)
+		if wtPath != target && !collision {
+			continue
+		}
+		current := wt.Branch
+		if current == "" {
+			current = "a detached HEAD"
+		}
+		if collision {
+			r.config.warnf("%s is the worktree %s of %s on this case-insensitive file system", worktreePath, wt.Path, current)
+		}
+		return fmt.Errorf("%w: %s is a worktree for %s, not %s", errPathIsWorktree, worktreePath, current, branchname)
+	}
+
+	return fmt.Errorf("%w: %s exists but is not a worktree, move or remove it first", ErrWorktreePathExists, worktreePath)
+}
+
+func branchHash(branchname string) string {
+	sum := sha1.Sum([]byte(branchname))
+	return hex.EncodeToString(sum[:])[:7]
+}
+
+// createWorktree adds a worktree for branchname at worktreePath and reports
+// whether a new local branch had to be created for it. If adding the worktree
+// fails or is interrupted, the new branch is removed again.
+func (r *GitRepo) createWorktree(ctx context.Context, branchname, worktreePath, from string) (created bool, err error) {
+	start := time.Now()
+	var ref plumbing.ReferenceName
+	var hash plumbing.Hash
+	created = !r.branchExistsLocally(branchname)
+
+	var refCreated, addStarted bool
+	// resetFrom is where -reset moved an existing branch from
+	var resetFrom *plumbing.Reference
+	defer func() {
+		if err != nil && addStarted {
+			// An interrupted git worktree add can leave the worktree behind
+			r.discardWorktree(worktreePath)
+		}
+		if err != nil && resetFrom != nil {
+			if restoreErr := r.repository.Storer.SetReference(resetFrom); restoreErr != nil {
+				r.config.warnf("Unable to restore branch %s to %s: %v", branchname, resetFrom.Hash().String()[:7], restoreErr)
+			}
+		}
+		if err != nil && refCreated {
+			if removeErr := r.discardBranch(branchname); removeErr != nil {
+				r.config.warnf("Unable to remove branch %s: %v", branchname, removeErr)
+			}
+		}
+	}()
+
+	if !r.config.ForceNewBranch && (created || r.config.Reset) && r.branchExistsOnRemote(branchname) {
+		remoteRef := plumbing.NewRemoteReferenceName(r.remote, branchname)
+		branchRef, err := r.repository.Reference(remoteRef, true)
+		if err != nil {
+			return false, fmt.Errorf("failed to get remote branch reference: %w", err)
+		}
+		hash = branchRef.Hash()
+		// Create local branch from remote, or with -reset move the existing
+		// one there
+		ref = plumbing.NewBranchReferenceName(branchname)
+		if r.config.DryRun {
+			action := "create"
+			if !created {
+				action = "reset"
+			}
+			r.config.dryRunf("%s branch %s from %s (%s)", action, branchname, remoteRef.Short(), hash.String()[:7])
+			return created, r.dryRunWorktreeAdd(branchname, worktreePath)
+		}
+		if !created {
+			if err := r.checkReset(ref, hash); err != nil {
+				return false, err
+			}
+			if resetFrom, err = r.repository.Reference(ref, false); err != nil {
+				return false, fmt.Errorf("failed to get local branch reference: %w", err)
+			}
+		}
+		localRef := plumbing.NewHashReference(ref, hash)
+		if err := r.repository.Storer.SetReference(localRef); err != nil {
+			resetFrom = nil
+			return false, fmt.Errorf("failed to create local branch: %w", err)
+		}
+		refCreated = created
+		if created && r.config.shouldTrack(true) {
+			if err := r.setUpstream(branchname); err != nil {
+				return false, err
+			}
+		}
+	} else if created {
+		// Create new branch from the requested base, or HEAD
+		base, err := r.resolveBase(from, false)
+		if err != nil {
+			return false, err
+		}
+		hash = base
+		ref = plumbing.NewBranchReferenceName(branchname)
+		if r.config.DryRun {
+			r.config.dryRunf("create branch %s from %s", branchname, hash.String()[:7])
+			return created, r.dryRunWorktreeAdd(branchname, worktreePath)
+		}
+		newRef := plumbing.NewHashReference(ref, hash)
+		if err := r.repository.Storer.SetReference(newRef); err != nil {
+			return false, fmt.Errorf("failed to create new branch: %w", err)
+		}
+		refCreated = true
+		if r.config.shouldTrack(false) {
+			if err := r.setUpstream(branchname); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	r.config.logDuration("branch resolution", start)
+
+	if r.config.DryRun {
+		return created, r.dryRunWorktreeAdd(branchname, worktreePath)
+	}
+
+	if r.config.configBool("worktree.nativeadd") {
+		addStart := time.Now()
+		err := r.addWorktreeNative(branchname, worktreePath)
+		r.config.logDuration("native worktree add", addStart)
+		if err == nil {
+			return created, nil
+		}
+		r.config.warnf("Unable to create the worktree natively, using git: %v", err)
+	}
+
+	// Create worktree using git command unless the native support is enabled,
+	// and as its fallback
+	cmd := r.config.tracer.commandContext(ctx, "git", "worktree", "add", worktreePath, branchname)
+	if r.config.NoLFSSmudge {
+		// Check out LFS pointer files instead of downloading the objects,
+		// git lfs pull fetches them later
+		cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1")
+	}
+	// Keep stderr for the error even when it is streamed in verbose mode
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if r.config.Verbose {
+		cmd.Stdout = r.getProgressWriter()
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	}
+	addStart := time.Now()
+	addStarted = true
+	err = cmd.Run()
+	r.config.logDuration("git worktree add", addStart)
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return created, fmt.Errorf("%w: %s", err, msg)
+		}
+	}
+	return created, err
+}
+
+// checkReset warns if resetting the local branch ref to hash drops commits that
+// are only on the local branch, naming the commit they can be recovered from,
+// since go-git writes no reflog.
+func (r *GitRepo) checkReset(ref plumbing.ReferenceName, hash plumbing.Hash) error {
+	local, err := r.repository.Reference(ref, true)
+	if err != nil {
+		return fmt.Errorf("failed to get local branch reference: %w", err)
+	}
+	if local.Hash() == hash {
+		return nil
+	}
+
+	localCommit, err := r.repository.CommitObject(local.Hash())
+	if err != nil {
+		return fmt.Errorf("failed to read local branch: %w", err)
+	}
+	remoteCommit, err := r.repository.CommitObject(hash)
+	if err != nil {
+		return fmt.Errorf("failed to read remote branch: %w", err)
+	}
+	if behind, err := localCommit.IsAncestor(remoteCommit); err == nil && !behind {
+		r.config.warnf("Reset %s to the remote, its local commits are still at %s", ref.Short(), local.Hash().String()[:7])
+	}
+	return nil
+}
+
+// discardWorktree removes the worktree at worktreePath if git registered it.
+// It doesn't take a context as it runs after an interrupt.
+func (r *GitRepo) discardWorktree(worktreePath string) {
+	r.config.tracer.command("git", "worktree", "remove", "--force", worktreePath).Run()
+}
+
+// discardBranch removes the branch createWorktree created, and its upstream.
+func (r *GitRepo) discardBranch(branchname string) error {
+	if err := r.repository.Storer.RemoveReference(plumbing.NewBranchReferenceName(branchname)); err != nil {
+		return err
+	}
+
+	cfg, err := r.repository.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read git config: %w", err)
+	}
+	if _, ok := cfg.Branches[branchname]; !ok {
+		return nil
+	}
+	delete(cfg.Branches, branchname)
+	return r.repository.SetConfig(cfg)
+}
+
+// setUpstream configures branchname to track the branch of the same name on
+// the configured remote.
+func (r *GitRepo) setUpstream(branchname string) error {
+	cfg, err := r.repository.Config()
+	if err != nil {
+		return fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	cfg.Branches[branchname] = &config.Branch{
+		Name:   branchname,
+		Remote: r.remote,
+		Merge:  plumbing.NewBranchReferenceName(branchname),
+	}
+	if err := r.repository.SetConfig(cfg); err != nil {
+		return fmt.Errorf("failed to set upstream for %s: %w", branchname, err)
+	}
+	return nil
+}
+
+// addDetachedWorktree adds a worktree at worktreePath with hash checked out
+// and no branch.
+func (r *GitRepo) addDetachedWorktree(ctx context.Context, worktreePath string, hash plumbing.Hash) error {
+	if r.config.DryRun {
+		r.config.dryRunf("git worktree add --detach %s %s", worktreePath, hash.String()[:7])
+		return nil
+	}
+
+	cmd := r.config.tracer.commandContext(ctx, "git", "worktree", "add", "--detach", worktreePath, hash.String())
+	if r.config.NoLFSSmudge {
+		cmd.Env = append(os.Environ(), "GIT_LFS_SKIP_SMUDGE=1")
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if r.config.Verbose {
+		cmd.Stdout = r.getProgressWriter()
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	}
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *GitRepo) dryRunWorktreeAdd(branchname, worktreePath string) error {
+	r.config.dryRunf("git worktree add %s %s", worktreePath, branchname)
+	return nil
+}
+
+// resolveBase returns the commit from names, or HEAD if it is empty, to base
+// a new branch or, with detach, a detached worktree on.
+func (r *GitRepo) resolveBase(from string, detach bool) (plumbing.Hash, error) {
+	if from == "" {
+		head, err := r.repository.Head()
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			// HEAD points at a branch without commits, named after
+			// init.defaultBranch in a new repository
+			if ref, refErr := r.repository.Reference(plumbing.HEAD, false); refErr == nil {
+				return plumbing.ZeroHash, fmt.Errorf("%w: make a first commit on %s", ErrNoCommits, ref.Target().Short())
+			}
+			return plumbing.ZeroHash, ErrNoCommits
+		}
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("failed to get HEAD: %w", err)
+		}
+		if head.Name() == plumbing.HEAD && !detach {
+			r.config.warnf("HEAD is detached, the new branch is based on commit %s", head.Hash().String()[:7])
+		}
+		return head.Hash(), nil
+	}
+
+	hash, err := r.repository.ResolveRevision(plumbing.Revision(from))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to resolve base ref %q: %w", from, err)
+	}
+	return *hash, nil
+}
+
+// defaultBranch returns the default branch of the repository:
+// worktree.basebranch, the branch the remote's HEAD points to, or main or
+// master, whichever exists.
+func (r *GitRepo) defaultBranch() (string, error) {
+	if branch := r.config.configValue("worktree.basebranch"); branch != "" {
+		return branch, nil
+	}
+	remoteHead, err := r.repository.Reference(plumbing.NewRemoteHEADReferenceName(r.remote), false)
+	if err == nil && remoteHead.Type() == plumbing.SymbolicReference {
+		return strings.TrimPrefix(remoteHead.Target().Short(), r.remote+"/"), nil
+	}
+	for _, branch := range []string{"main", "master"} {
+		if r.branchExistsOnRemote(branch) || r.branchExistsLocally(branch) {
+			return branch, nil
+		}
+	}
+	return "", fmt.Errorf("%w, run git remote set-head %s --auto or set worktree.basebranch", ErrNoDefaultBranch, r.remote)
+}
+
+// getProgressWriter returns where progress is written in verbose mode, or a
+// nil io.Writer, not a nil *os.File, which go-git would fail to write to.
+func (r *GitRepo) getProgressWriter() io.Writer {
+	if r.config.Verbose {
+		// Keep stdout clean for the JSON result or path
+		if r.config.machineOutput() {
+			return os.Stderr
+		}
+		return os.Stdout
+	}
+	return nil
+}
+
+// detachedHead reports whether HEAD points at a commit instead of a branch.
+func (r *GitRepo) detachedHead() bool {
+	head, err := r.repository.Head()
+	return err == nil && head.Name() == plumbing.HEAD
+}
+
+func (r *GitRepo) branchExistsLocally(branchname string) bool {
+	_, err := r.repository.Reference(plumbing.NewBranchReferenceName(branchname), true)
+	return err == nil
+}
+
+// fetchBranch updates the remote-tracking branch of branchname. A branch that
+// doesn't exist on the remote is not an error.
+func (r *GitRepo) fetchBranch(ctx context.Context, branchname string) error {
+	auth, err := r.getAuth()
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return fmt.Errorf("%w: %s", ErrRemoteNotFound, r.remote)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get authentication: %w", err)
+	}
+
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s",
+		plumbing.NewBranchReferenceName(branchname),
+		plumbing.NewRemoteReferenceName(r.remote, branchname)))
+	caBundle, proxy, err := r.httpOptions()
+	if err != nil {
+		return err
+	}
+	err = r.repository.FetchContext(ctx, &git.FetchOptions{
+		RemoteName:   r.remote,
+		RefSpecs:     []config.RefSpec{refSpec},
+		Auth:         auth,
+		Progress:     r.getProgressWriter(),
+		CABundle:     caBundle,
+		ProxyOptions: proxy,
+	})
+	switch {
+	case err == nil, errors.Is(err, git.NoErrAlreadyUpToDate), errors.Is(err, git.NoMatchingRefSpecError{}):
+		return nil
+	default:
+		return r.remoteError(err)
+	}
+}
+
+// pushBranch pushes branchname to the branch of the same name on the remote
+// and sets it as the upstream. Like a fetch, it runs no git hooks.
+func (r *GitRepo) pushBranch(ctx context.Context, branchname string) error {
+	auth, err := r.getAuth()
+	if errors.Is(err, git.ErrRemoteNotFound) {
+		return fmt.Errorf("%w: %s", ErrRemoteNotFound, r.remote)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get authentication: %w", err)
+	}
+
+	ref := plumbing.NewBranchReferenceName(branchname)
+	caBundle, proxy, err := r.httpOptions()
+	if err != nil {
+		return err
+	}
+	err = r.repository.PushContext(ctx, &git.PushOptions{
+		RemoteName:   r.remote,
+		RefSpecs:     []config.RefSpec{config.RefSpec(fmt.Sprintf("%s:%s", ref, ref))},
+		Auth:         auth,
+		Progress:     r.getProgressWriter(),
+		CABundle:     caBundle,
+		ProxyOptions: proxy,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return r.remoteError(err)
+	}
+	return r.setUpstream(branchname)
+}
+
+func (r *GitRepo) branchExistsOnRemote(branchname string) bool {
+	remoteRef := plumbing.NewRemoteReferenceName(r.remote, branchname)
+	_, err := r.repository.Reference(remoteRef, true)
+	return err == nil
+}
+
+type WorktreeInfo struct {
+	Path     string
+	Head     string
+	Branch   string
+	Detached bool
+	Bare     bool
+	// Prunable is set when the worktree directory no longer exists
+	Prunable bool
+}
+
+func (r *GitRepo) listWorktrees(ctx context.Context) ([]WorktreeInfo, error) {
+	cmd := r.config.tracer.commandContext(ctx, "git", "worktree", "list", "--porcelain")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list worktrees: %w", err)
+	}
+
+	var worktrees []WorktreeInfo
+	var current *WorktreeInfo
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, _ := strings.Cut(line, " ")
+		switch key {
+		case "worktree":
+			worktrees = append(worktrees, WorktreeInfo{Path: value})
+			current = &worktrees[len(worktrees)-1]
+		case "HEAD":
+			if current != nil {
+				current.Head = value
+			}
+		case "branch":
+			if current != nil {
+				current.Branch = strings.TrimPrefix(value, "refs/heads/")
+			}
+		case "detached":
+			if current != nil {
+				current.Detached = true
+			}
+		case "bare":
+			if current != nil {
+				current.Bare = true
+			}
+		case "prunable":
+			if current != nil {
+				current.Prunable = true
+			}
+		}
+	}
+
+	return worktrees, nil
+}
+
+// upstreamBranch returns the configured upstream of a local branch, such as
+// origin/main. It is reported even if the upstream no longer exists.
+func (r *GitRepo) upstreamBranch(ctx context.Context, branchname string) string {
+	if branchname == "" {
+		return ""
+	}
+	cmd := r.config.tracer.commandContext(ctx, "git", "for-each-ref", "--format=%(upstream:short)", "refs/heads/"+branchname)
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// upstreamGone reports whether the upstream of branchname is configured but
+// no longer exists, on whichever remote it is, or locally.
+func (r *GitRepo) upstreamGone(ctx context.Context, branchname string) bool {
+	cmd := r.config.tracer.commandContext(ctx, "git", "for-each-ref", "--format=%(upstream:track)", "refs/heads/"+branchname)
+	output, err := cmd.Output()
+	return err == nil && strings.TrimSpace(string(output)) == "[gone]"
+}
+
+func (r *GitRepo) hasChanges(ctx context.Context, worktreePath string) (bool, error) {
+	cmd := r.config.tracer.commandContext(ctx, "git", "-C", worktreePath, "status", "--porcelain")
+	output, err := cmd.Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to get status of %s: %w", worktreePath, err)
+	}
+	return strings.TrimSpace(string(output)) != "", nil
+}
+
+// carryChanges moves the uncommitted changes to tracked files from the
+// repository into the worktree at worktreePath. If they don't apply cleanly,
+// they are left in the stash.
+func (r *GitRepo) carryChanges(ctx context.Context, branchname, worktreePath string) error {
+	if r.config.DryRun {
+		r.config.dryRunf("move uncommitted changes to %s", worktreePath)
+		return nil
+	}
+
+	before := r.stashHead(ctx)
+	var output bytes.Buffer
+	stash := r.config.tracer.commandContext(ctx, "git", "stash", "push", "-m", "worktree: carry changes to "+branchname)
+	stash.Dir = r.root
+	stash.Stdout = &output
+	stash.Stderr = &output
+	if err := stash.Run(); err != nil {
+		return fmt.Errorf("failed to stash changes: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+	if r.stashHead(ctx) == before {
+		// Nothing to carry over
+		return nil
+	}
+
+	output.Reset()
+	pop := r.config.tracer.commandContext(ctx, "git", "stash", "pop", "--index")
+	pop.Dir = worktreePath
+	pop.Stdout = &output
+	pop.Stderr = &output
+	if err := pop.Run(); err != nil {
+		return fmt.Errorf("changes didn't apply cleanly and are kept in the stash: %s", strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// stashHead returns the commit of the latest stash entry, or "" if the stash
+// is empty.
+func (r *GitRepo) stashHead(ctx context.Context) string {
+	cmd := r.config.tracer.commandContext(ctx, "git", "rev-parse", "-q", "--verify", "refs/stash")
+	cmd.Dir = r.root
+	output, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
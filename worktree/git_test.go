@@ -0,0 +1,222 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+func TestPullError(t *testing.T) {
+	other := errors.New("connection reset")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no upstream", plumbing.ErrReferenceNotFound, ErrNoUpstream},
+		{"wrapped no upstream", fmt.Errorf("pull: %w", plumbing.ErrReferenceNotFound), ErrNoUpstream},
+		{"remote not found", git.ErrRemoteNotFound, ErrRemoteNotFound},
+		{"authentication required", transport.ErrAuthenticationRequired, ErrAuthFailed},
+		{"authorization failed", transport.ErrAuthorizationFailed, ErrAuthFailed},
+		{"repository not found", transport.ErrRepositoryNotFound, ErrAuthFailed},
+		{"other", other, other},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pullError(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("pullError(%v) = %v, want it to wrap %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, true},
+		{"connection reset", &net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, true},
+		{"connection refused", fmt.Errorf("failed to pull: %w", syscall.ECONNREFUSED), true},
+		{"unreachable", fmt.Errorf("failed to pull: %w", syscall.ENETUNREACH), true},
+		{"not a timeout", &net.DNSError{Err: "no such host", Name: "example.invalid"}, false},
+		{"message only", errors.New("read: connection reset by peer, timeout"), false},
+		{"auth failed", fmt.Errorf("%w: %v", ErrAuthFailed, syscall.ECONNRESET), false},
+		{"no upstream", pullError(plumbing.ErrReferenceNotFound), false},
+		{"remote not found", pullError(git.ErrRemoteNotFound), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransientError(tt.err); got != tt.want {
+				t.Errorf("isTransientError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// newBareLayout returns a directory holding a bare repository in .bare, with
+// main checked out in the linked worktree main.
+func newBareLayout(t *testing.T) string {
+	t.Helper()
+	src := newTestRepo(t)
+	run(t, src, "git", "checkout", "-q", "-b", "main")
+	run(t, src, "git", "commit", "-q", "--allow-empty", "-m", "initial")
+	project, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	run(t, project, "git", "clone", "-q", "--bare", src, ".bare")
+	run(t, project, "git", "--git-dir", ".bare", "worktree", "add", "-q", "main", "main")
+	if err := os.Mkdir(filepath.Join(project, "main", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return project
+}
+
+func TestInitGitRepoBareLayout(t *testing.T) {
+	project := newBareLayout(t)
+	bare := filepath.Join(project, ".bare")
+	main := filepath.Join(project, "main")
+
+	tests := []struct {
+		name        string
+		cwd         string
+		wantBare    bool
+		wantRoot    string
+		wantBaseDir string
+	}{
+		{name: "bare repository", cwd: bare, wantBare: true, wantRoot: bare, wantBaseDir: project},
+		{name: "linked worktree", cwd: main, wantRoot: main, wantBaseDir: ".."},
+		{name: "below linked worktree", cwd: filepath.Join(main, "sub"), wantRoot: main, wantBaseDir: ".."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(tt.cwd)
+			wm := NewWorktreeManager(Config{Quiet: true, Logger: log.New(io.Discard, "", 0)})
+			repo, err := wm.initGitRepo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo.bare != tt.wantBare || repo.root != tt.wantRoot {
+				t.Errorf("initGitRepo = bare %v, root %s, want bare %v, root %s", repo.bare, repo.root, tt.wantBare, tt.wantRoot)
+			}
+			// Paths are relative to the root, which is changed into
+			if cwd, _ := os.Getwd(); cwd != tt.wantRoot {
+				t.Errorf("current directory = %s, want %s", cwd, tt.wantRoot)
+			}
+			if commonDir, err := repo.commonDir(); err != nil || commonDir != bare {
+				t.Errorf("commonDir = %s, %v, want %s", commonDir, err, bare)
+			}
+			if baseDir, err := repo.worktreeBaseDir(); err != nil || baseDir != tt.wantBaseDir {
+				t.Errorf("worktreeBaseDir = %s, %v, want %s", baseDir, err, tt.wantBaseDir)
+			}
+			// The worktree of main is found from everywhere
+			baseDir, _ := repo.worktreeBaseDir()
+			path, existing, err := repo.resolveWorktreePath(context.Background(), baseDir, "main")
+			if err != nil || !existing || path != main {
+				t.Errorf("resolveWorktreePath(main) = %s, %v, %v, want existing %s", path, existing, err, main)
+			}
+		})
+	}
+}
+
+func TestCreateWorktreeFromBare(t *testing.T) {
+	project := newBareLayout(t)
+	t.Chdir(filepath.Join(project, ".bare"))
+
+	wm := NewWorktreeManager(Config{NoCopy: true, NoChdir: true, Quiet: true, Logger: log.New(io.Discard, "", 0)})
+	path, err := wm.CreateWorktree(context.Background(), "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(project, "feature"); path != want {
+		t.Errorf("CreateWorktree = %s, want %s", path, want)
+	}
+	if head := run(t, path, "git", "rev-parse", "--abbrev-ref", "HEAD"); head != "feature" {
+		t.Errorf("worktree HEAD = %q, want feature", head)
+	}
+}
+
+func TestResolveBaseDetachedHead(t *testing.T) {
+	dir := newTestRepo(t)
+	run(t, dir, "git", "checkout", "-q", "-b", "main")
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "first")
+	first := run(t, dir, "git", "rev-parse", "HEAD")
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "second")
+	second := run(t, dir, "git", "rev-parse", "HEAD")
+
+	tests := []struct {
+		name     string
+		checkout string
+		from     string
+		detach   bool
+		want     string
+		wantWarn bool
+	}{
+		{name: "on a branch", checkout: "main", want: second},
+		{name: "detached HEAD", checkout: first, want: first, wantWarn: true},
+		{name: "detached HEAD for a detached worktree", checkout: first, detach: true, want: first},
+		{name: "detached HEAD with a base", checkout: first, from: "main", want: second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			run(t, dir, "git", "checkout", "-q", tt.checkout)
+			var output bytes.Buffer
+			wm := NewWorktreeManager(Config{Logger: log.New(&output, "", 0)})
+			repo, err := wm.initGitRepo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if detached := repo.detachedHead(); detached != (tt.checkout != "main") {
+				t.Errorf("detachedHead = %v", detached)
+			}
+
+			hash, err := repo.resolveBase(tt.from, tt.detach)
+			if err != nil || hash.String() != tt.want {
+				t.Errorf("resolveBase(%q, %v) = %s, %v, want %s", tt.from, tt.detach, hash, err, tt.want)
+			}
+			warning := "HEAD is detached, the new branch is based on commit " + first[:7]
+			if warned := strings.Contains(output.String(), warning); warned != tt.wantWarn {
+				t.Errorf("warned = %v, want %v:\n%s", warned, tt.wantWarn, output.String())
+			}
+		})
+	}
+}
+
+func TestCreateWorktreeDetachedHead(t *testing.T) {
+	dir := newTestRepo(t)
+	run(t, dir, "git", "checkout", "-q", "-b", "main")
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "first")
+	first := run(t, dir, "git", "rev-parse", "HEAD")
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "second")
+	run(t, dir, "git", "checkout", "-q", first)
+
+	var output bytes.Buffer
+	wm := NewWorktreeManager(Config{NoCopy: true, NoChdir: true, Logger: log.New(&output, "", 0)})
+	path, err := wm.CreateWorktree(context.Background(), "feature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head := run(t, path, "git", "rev-parse", "feature"); head != first {
+		t.Errorf("feature = %s, want the detached commit %s", head, first)
+	}
+	if !strings.Contains(output.String(), "HEAD is detached") {
+		t.Errorf("no warning about the detached HEAD:\n%s", output.String())
+	}
+}
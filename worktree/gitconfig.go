@@ -0,0 +1,131 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultGitConfigKeys are the keys copied by -copy-git-config unless
+// worktree.gitconfigkeys is set.
+var defaultGitConfigKeys = []string{"user.name", "user.email", "user.signingkey"}
+
+// copyGitConfig copies the repository and worktree scoped values of the keys
+// in worktree.gitconfigkeys into the config of the new worktree, and installs
+// the hooks in worktree.hooksdir for it alone. Per-worktree config needs
+// extensions.worktreeConfig, which is enabled if it isn't.
+func (r *GitRepo) copyGitConfig(ctx context.Context, worktreePath string) error {
+	keys := r.config.configValues("worktree.gitconfigkeys")
+	if len(keys) == 0 {
+		keys = defaultGitConfigKeys
+	}
+
+	values := make(map[string][]string)
+	for _, key := range keys {
+		if v := r.localConfigValues(ctx, key); len(v) > 0 {
+			values[key] = v
+		}
+	}
+	hooksDir := expandHome(r.config.configValue("worktree.hooksdir"))
+	if len(values) == 0 && hooksDir == "" {
+		return nil
+	}
+
+	if r.config.DryRun {
+		for _, key := range keys {
+			for _, value := range values[key] {
+				r.config.dryRunf("git config --worktree %s %s in %s", key, value, worktreePath)
+			}
+		}
+		if hooksDir != "" {
+			r.config.dryRunf("install hooks from %s in %s", hooksDir, worktreePath)
+		}
+		return nil
+	}
+
+	if !r.config.gitConfigBool("extensions.worktreeConfig") {
+		if err := r.config.tracer.commandContext(ctx, "git", "config", "extensions.worktreeConfig", "true").Run(); err != nil {
+			return fmt.Errorf("failed to enable extensions.worktreeConfig: %w", err)
+		}
+	}
+
+	for _, key := range keys {
+		for i, value := range values[key] {
+			args := []string{"-C", worktreePath, "config", "--worktree"}
+			if i > 0 {
+				args = append(args, "--add")
+			}
+			args = append(args, key, value)
+			if output, err := r.config.tracer.commandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+				return fmt.Errorf("failed to set %s: %w: %s", key, err, strings.TrimSpace(string(output)))
+			}
+		}
+	}
+
+	if hooksDir != "" {
+		if err := r.installHooks(ctx, hooksDir, worktreePath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// localConfigValues returns the values of key set for the current worktree,
+// or else for the repository. Global and system config are left out, the new
+// worktree sees them anyway.
+func (r *GitRepo) localConfigValues(ctx context.Context, key string) []string {
+	output, err := r.config.tracer.commandContext(ctx, "git", "config", "--show-scope", "--get-all", key).Output()
+	if err != nil {
+		return nil
+	}
+
+	values := make(map[string][]string)
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if scope, value, ok := strings.Cut(line, "\t"); ok {
+			values[scope] = append(values[scope], value)
+		}
+	}
+	if len(values["worktree"]) > 0 {
+		return values["worktree"]
+	}
+	return values["local"]
+}
+
+// installHooks copies the hooks in hooksDir into the administrative directory
+// of the worktree and points its core.hooksPath there, so that the other
+// worktrees keep the repository's hooks.
+func (r *GitRepo) installHooks(ctx context.Context, hooksDir, worktreePath string) error {
+	output, err := r.config.tracer.commandContext(ctx, "git", "-C", worktreePath, "rev-parse", "--absolute-git-dir").Output()
+	if err != nil {
+		return fmt.Errorf("failed to locate the worktree's git directory: %w", err)
+	}
+	dest := filepath.Join(strings.TrimSpace(string(output)), "hooks")
+
+	entries, err := os.ReadDir(hooksDir)
+	if err != nil {
+		return fmt.Errorf("failed to read worktree.hooksdir: %w", err)
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(hooksDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read hook %s: %w", entry.Name(), err)
+		}
+		if err := os.WriteFile(filepath.Join(dest, entry.Name()), data, 0o755); err != nil {
+			return fmt.Errorf("failed to install hook %s: %w", entry.Name(), err)
+		}
+	}
+
+	cmd := r.config.tracer.commandContext(ctx, "git", "-C", worktreePath, "config", "--worktree", "core.hooksPath", dest)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set core.hooksPath: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
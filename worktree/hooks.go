@@ -0,0 +1,65 @@
+package worktree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var ErrHookFailed = errors.New("post-create hook failed")
+
+// runPostCreateHooks runs the worktree.postcreate commands in order inside the
+// new worktree, stopping at the first one that fails.
+func (wm *WorktreeManager) runPostCreateHooks(ctx context.Context, branchname, worktreePath string) error {
+	hooks := wm.config.configValues("worktree.postcreate")
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+
+	for _, hook := range hooks {
+		if wm.config.DryRun {
+			wm.config.dryRunf("run %q in %s", hook, worktreePath)
+			continue
+		}
+
+		var output bytes.Buffer
+		cmd := wm.tracer.shellCommand(ctx, hook)
+		cmd.Dir = absPath
+		cmd.Env = hookEnv(branchname, absPath)
+		if wm.config.Verbose {
+			cmd.Stdout = wm.repo.getProgressWriter()
+			cmd.Stderr = os.Stderr
+		} else {
+			cmd.Stdout = &output
+			cmd.Stderr = &output
+		}
+
+		if err := cmd.Run(); err != nil {
+			if out := strings.TrimSpace(output.String()); out != "" {
+				io.WriteString(os.Stderr, out+"\n")
+			}
+			return fmt.Errorf("%w: %q: %v (worktree kept at %s)", ErrHookFailed, hook, err, worktreePath)
+		}
+	}
+
+	return nil
+}
+
+// hookEnv returns the environment of commands run for a new worktree, which
+// tells them its branch and absolute path.
+func hookEnv(branchname, absPath string) []string {
+	return append(os.Environ(),
+		"WORKTREE_BRANCH="+branchname,
+		"WORKTREE_PATH="+absPath,
+	)
+}
@@ -0,0 +1,78 @@
+package worktree
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	// issueKey matches issue keys as used by Jira and Linear, such as PROJ-123
+	issueKey = regexp.MustCompile(`^[A-Z][A-Z0-9]+-[0-9]+$`)
+	// slugInvalid matches what doesn't belong in a branch name slug
+	slugInvalid = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// IsURL reports whether s is an http(s) URL rather than a branch name.
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "https://") || strings.HasPrefix(s, "http://")
+}
+
+// BranchFromURL derives a branch name from an issue URL. The regular
+// expression in worktree.branchfromurl is tried first, its first group or else
+// the whole match is the name. Otherwise an issue key such as PROJ-123 in the
+// path is used, with the path segments after it as in PROJ-123-fix-login, and
+// then an issues/<number> path as issue-<number>. It reports false if nothing
+// matches.
+func (wm *WorktreeManager) BranchFromURL(rawURL string) (string, bool, error) {
+	if err := wm.config.loadConfigFile(); err != nil {
+		return "", false, err
+	}
+
+	if pattern := wm.config.configValue("worktree.branchfromurl"); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			wm.config.warnf("Ignoring invalid worktree.branchfromurl %q: %v", pattern, err)
+		} else if match := re.FindStringSubmatch(rawURL); match != nil {
+			slug := match[0]
+			if len(match) > 1 {
+				slug = match[1]
+			}
+			if slug = branchSlug(slug); slug != "" {
+				return slug, true, nil
+			}
+		}
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", false, nil
+	}
+	// Jira boards link to the selected issue in the query
+	if key := parsed.Query().Get("selectedIssue"); issueKey.MatchString(key) {
+		return key, true, nil
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(parsed.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	for i, segment := range segments {
+		if issueKey.MatchString(segment) {
+			return branchSlug(strings.Join(segments[i:], "-")), true, nil
+		}
+	}
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] == "issues" {
+			return "issue-" + branchSlug(segments[i+1]), true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// branchSlug replaces what isn't allowed or wanted in a branch name with "-".
+func branchSlug(s string) string {
+	return strings.Trim(slugInvalid.ReplaceAllString(s, "-"), "-.")
+}
@@ -0,0 +1,62 @@
+package worktree
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isolateGitConfig keeps the user's and the system's git config and config
+// file out of the test, and runs it outside of any repository.
+func isolateGitConfig(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(dir, "gitconfig"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Chdir(dir)
+}
+
+func TestBranchFromURL(t *testing.T) {
+	isolateGitConfig(t)
+	tests := []struct {
+		name    string
+		pattern string
+		url     string
+		want    string
+		ok      bool
+	}{
+		{name: "jira browse", url: "https://example.atlassian.net/browse/PROJ-123", want: "PROJ-123", ok: true},
+		{name: "jira board", url: "https://example.atlassian.net/jira/board?selectedIssue=PROJ-7", want: "PROJ-7", ok: true},
+		{name: "linear", url: "https://linear.app/team/issue/ENG-42/fix-the-login", want: "ENG-42-fix-the-login", ok: true},
+		{name: "github issue", url: "https://github.com/bueti/go-worktree/issues/17", want: "issue-17", ok: true},
+		{name: "gitlab issue", url: "https://gitlab.com/group/project/-/issues/5", want: "issue-5", ok: true},
+		{name: "lowercase key", url: "https://example.com/browse/proj-123"},
+		{name: "nothing", url: "https://example.com/"},
+		{name: "pattern group", pattern: `tickets/(\d+)`, url: "https://tracker.example.com/tickets/99", want: "99", ok: true},
+		{name: "pattern match", pattern: `T-\d+`, url: "https://tracker.example.com/view/T-99", want: "T-99", ok: true},
+		{name: "pattern slug", pattern: `view/(.*)`, url: "https://tracker.example.com/view/Fix login!", want: "Fix-login", ok: true},
+		{name: "pattern without match", pattern: `tickets/(\d+)`, url: "https://github.com/bueti/go-worktree/issues/17", want: "issue-17", ok: true},
+		{name: "invalid pattern", pattern: `tickets/(`, url: "https://github.com/bueti/go-worktree/issues/17", want: "issue-17", ok: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Logger: log.New(io.Discard, "", 0)}
+			if tt.pattern != "" {
+				cfg.ConfigFile = filepath.Join(t.TempDir(), "config.yaml")
+				if err := os.WriteFile(cfg.ConfigFile, []byte("branchfromurl: '"+tt.pattern+"'\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, ok, err := NewWorktreeManager(cfg).BranchFromURL(tt.url)
+			if err != nil {
+				t.Fatalf("BranchFromURL(%q) = %v", tt.url, err)
+			}
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("BranchFromURL(%q) = %q, %v, want %q, %v", tt.url, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
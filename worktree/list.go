@@ -0,0 +1,92 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func (wm *WorktreeManager) ListWorktrees(ctx context.Context) error {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return err
+	}
+	wm.repo = repo
+
+	worktrees, err := repo.listWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+
+	active := resolvePath(repo.root)
+
+	rows := make([][]string, 0, len(worktrees))
+	for _, wt := range worktrees {
+		branch := wt.Branch
+		switch {
+		case wt.Bare:
+			branch = "(bare)"
+		case wt.Detached:
+			branch = "(detached)"
+		}
+
+		head := wt.Head
+		if len(head) > 7 {
+			head = head[:7]
+		}
+
+		row := []string{wt.Path, branch, head}
+		if wm.config.Verbose && !wt.Bare {
+			upstream := repo.upstreamBranch(ctx, wt.Branch)
+			if upstream == "" {
+				upstream = "-"
+			}
+			status := "clean"
+			dirty, err := repo.hasChanges(ctx, wt.Path)
+			if err != nil {
+				status = "unknown"
+			} else if dirty {
+				status = "modified"
+			}
+			row = append(row, upstream, status)
+		}
+		rows = append(rows, row)
+	}
+
+	widths := make([]int, 0)
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			widths[i] = max(widths[i], len(cell))
+		}
+	}
+
+	for i, row := range rows {
+		cells := make([]string, len(row))
+		for j, cell := range row {
+			cells[j] = fmt.Sprintf("%-*s", widths[j], cell)
+		}
+		line := strings.TrimRight(strings.Join(cells, "  "), " ")
+
+		switch {
+		case resolvePath(worktrees[i].Path) == active:
+			line = wm.config.Paint(os.Stdout, Green, line)
+		case worktrees[i].Detached:
+			line = wm.config.Paint(os.Stdout, Yellow, line)
+		}
+		fmt.Fprintln(os.Stdout, line)
+	}
+
+	return nil
+}
+
+func resolvePath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,77 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var ErrLocked = errors.New("another worktree operation is in progress")
+
+const (
+	lockFile     = "worktree-tool.lock"
+	lockInterval = 100 * time.Millisecond
+)
+
+// lockTimeout is how long lock waits for another invocation, a variable so
+// that tests don't wait as long
+var lockTimeout = 30 * time.Second
+
+// errLockHeld is returned by tryLock when another open file holds the lock.
+var errLockHeld = errors.New("lock is held")
+
+// lock takes the lock of the repository, which keeps concurrent invocations
+// from racing on creating the same branch and worktree, and returns the
+// function releasing it. The lock is an flock, or LockFileEx on Windows, on a
+// file in the common git directory, so it covers every worktree of the
+// repository and is released by the OS when its holder exits, even if it
+// crashed. The file itself is left behind and only records the PID of the
+// last holder. If another invocation holds it, lock waits for up to
+// lockTimeout.
+func (r *GitRepo) lock(ctx context.Context) (func(), error) {
+	commonDir, err := r.commonDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(commonDir, lockFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(lockTimeout)
+	waiting := false
+	for {
+		err := tryLock(f)
+		if err == nil {
+			if f.Truncate(0) == nil {
+				fmt.Fprintf(f, "%d\n", os.Getpid())
+			}
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		if !errors.Is(err, errLockHeld) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("%w, waited %s for the command holding %s", ErrLocked, lockTimeout, path)
+		}
+		if !waiting {
+			r.config.statusf(Yellow, "waiting for another worktree operation to finish")
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, ctx.Err()
+		case <-time.After(lockInterval):
+		}
+	}
+}
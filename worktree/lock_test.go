@@ -0,0 +1,209 @@
+package worktree
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newLockTestRepo(t *testing.T) *GitRepo {
+	t.Helper()
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return &GitRepo{root: root, config: &Config{Quiet: true, Logger: log.New(io.Discard, "", 0)}}
+}
+
+func TestLock(t *testing.T) {
+	repo := newLockTestRepo(t)
+	path := filepath.Join(repo.root, ".git", lockFile)
+
+	tests := []struct {
+		name string
+		// held takes the lock before and releases it after the timeout
+		held    bool
+		timeout time.Duration
+		wantErr error
+	}{
+		{name: "free", timeout: time.Second},
+		{name: "free again after release", timeout: time.Second},
+		{name: "held", held: true, timeout: 3 * lockInterval, wantErr: context.DeadlineExceeded},
+		{name: "free after held", timeout: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.held {
+				unlock, err := repo.lock(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer unlock()
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			unlock, err := repo.lock(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("lock = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("lock file missing while held: %v", err)
+			}
+			unlock()
+		})
+	}
+}
+
+func TestLockWaitsForRelease(t *testing.T) {
+	repo := newLockTestRepo(t)
+	unlock, err := repo.lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		time.Sleep(2 * lockInterval)
+		unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	release, err := repo.lock(ctx)
+	if err != nil {
+		t.Fatalf("lock after release = %v", err)
+	}
+	release()
+}
+
+func TestLockLeftoverFile(t *testing.T) {
+	repo := newLockTestRepo(t)
+	path := filepath.Join(repo.root, ".git", lockFile)
+	if err := os.WriteFile(path, []byte("1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), lockInterval)
+	defer cancel()
+	unlock, err := repo.lock(ctx)
+	if err != nil {
+		t.Fatalf("lock with a leftover lock file = %v", err)
+	}
+	unlock()
+}
+
+func TestLockTimeout(t *testing.T) {
+	repo := newLockTestRepo(t)
+	timeout := lockTimeout
+	lockTimeout = 3 * lockInterval
+	t.Cleanup(func() { lockTimeout = timeout })
+
+	unlock, err := repo.lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	if _, err := repo.lock(context.Background()); !errors.Is(err, ErrLocked) {
+		t.Errorf("lock while held = %v, want ErrLocked", err)
+	}
+}
+
+// TestLockHelperProcess isn't a test, TestLockKilledHolder runs it in
+// another process to hold the lock until it is killed.
+func TestLockHelperProcess(t *testing.T) {
+	root := os.Getenv("WORKTREE_LOCK_HELPER")
+	if root == "" {
+		t.Skip("only run by TestLockKilledHolder")
+	}
+	repo := &GitRepo{root: root, config: &Config{Quiet: true, Logger: log.New(io.Discard, "", 0)}}
+	if _, err := repo.lock(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	fmt.Println("locked")
+	time.Sleep(time.Minute)
+}
+
+func TestLockKilledHolder(t *testing.T) {
+	repo := newLockTestRepo(t)
+	cmd := exec.Command(os.Args[0], "-test.run=^TestLockHelperProcess$")
+	cmd.Env = append(os.Environ(), "WORKTREE_LOCK_HELPER="+repo.root)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil || line != "locked\n" {
+		cmd.Process.Kill()
+		t.Fatalf("helper process = %q, %v", line, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockInterval)
+	defer cancel()
+	if _, err := repo.lock(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("lock held by another process = %v, want it to wait", err)
+	}
+
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+	ctx, cancel = context.WithTimeout(context.Background(), lockInterval)
+	defer cancel()
+	unlock, err := repo.lock(ctx)
+	if err != nil {
+		t.Fatalf("lock after its holder was killed = %v", err)
+	}
+	unlock()
+}
+
+func TestCreateWorktreeConcurrent(t *testing.T) {
+	dir := newTestRepo(t)
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "initial")
+
+	var created atomic.Int32
+	events := Events{WorktreeCreated: func(branch, path string) { created.Add(1) }}
+	paths := make([]string, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i := range paths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wm := NewWorktreeManager(Config{NoCopy: true, NoChdir: true, NoPull: true, Quiet: true, Events: events, Logger: log.New(io.Discard, "", 0)})
+			paths[i], errs[i] = wm.CreateWorktree(context.Background(), "feature")
+		}()
+	}
+	wg.Wait()
+
+	// One invocation adds the worktree, the other waits for it and uses it
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("CreateWorktree %d = %v", i, err)
+		}
+	}
+	if paths[0] != paths[1] {
+		t.Errorf("CreateWorktree paths = %q, %q, want the same worktree", paths[0], paths[1])
+	}
+	if n := created.Load(); n != 1 {
+		t.Errorf("worktree created %d times, want once", n)
+	}
+	if list := run(t, dir, "git", "worktree", "list", "--porcelain"); strings.Count(list, "worktree ") != 2 {
+		t.Errorf("git worktree list:\n%s", list)
+	}
+}
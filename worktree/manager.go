@@ -0,0 +1,848 @@
+// Package worktree creates and manages git worktrees, copying over untracked
+// files such as .env that a fresh checkout would be missing.
+package worktree
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+var (
+	ErrNotInGitRepo           = errors.New("not in a git repository")
+	ErrWorktreeCreationFailed = errors.New("failed to create git worktree")
+	ErrWorktreePathExists     = errors.New("worktree path already exists")
+	ErrNoUpstream             = errors.New("no upstream configured for current branch")
+	ErrRemoteNotFound         = errors.New("remote not found")
+	ErrAuthFailed             = errors.New("authentication failed or repository not accessible")
+	ErrBranchExists           = errors.New("branch already exists")
+	ErrStaleWorktree          = errors.New("worktree no longer exists")
+	ErrNoCommits              = errors.New("the repository has no commits yet")
+	ErrResetCheckedOut        = errors.New("can't reset a branch that is checked out in a worktree")
+	ErrDetachConflict         = errors.New("-detach creates no branch and can't be combined with -pr, -track, -no-track, or -force-new-branch")
+	ErrFromConflict           = errors.New("-from and -from-default can't be combined")
+	ErrNoDefaultBranch        = errors.New("can't determine the default branch")
+	ErrPushFailed             = errors.New("failed to push the new branch")
+	ErrBranchInMainWorktree   = errors.New("branch is checked out in the main worktree")
+)
+
+type Config struct {
+	Verbose        bool
+	Trace          bool
+	From           string
+	NoCopy         bool
+	NoPull         bool
+	NoFetch        bool
+	NoPrefix       bool
+	Track          bool
+	NoTrack        bool
+	PullTimeout    time.Duration
+	DryRun         bool
+	OpenEditor     bool
+	Force          bool
+	DeleteBranch   bool
+	Gone           bool
+	JSON           bool
+	PrintPath      bool
+	Quiet          bool
+	CarryChanges   bool
+	ForceNewBranch bool
+	NoLFSSmudge    bool
+	Link           bool
+	CopyFrom       string
+	ConfigFile     string
+	PR             int
+	NoColor        bool
+	Suffix         string
+	Timestamp      bool
+	CopyGitConfig  bool
+	Detach         bool
+	Reset          bool
+	Overwrite      bool
+	FromDefault    bool
+	NoChdir        bool
+	Tmux           bool
+	AsBranch       bool
+	HardlinkDeps   bool
+	PushNew        bool
+	CopyPatterns   []string
+	Logger         *log.Logger
+	Events         Events
+
+	// warnings collects non-fatal warnings for the JSON output
+	warnings []string
+	// file holds the settings from the config file, by git config key
+	file map[string][]string
+	// tracer is the tracer of the WorktreeManager, for the commands run by
+	// the config readers and the helpers that only have the config
+	tracer *tracer
+}
+
+// CreateResult is what CreateWorktree did, printed as JSON with Config.JSON
+// and as a summary otherwise. Base, NodeModules, and Direnv are only set for
+// a new worktree.
+type CreateResult struct {
+	Branch      string      `json:"branch"`
+	Path        string      `json:"path"`
+	Created     bool        `json:"created"`
+	Base        string      `json:"base,omitempty"`
+	Copied      []string    `json:"copied"`
+	NodeModules string      `json:"node_modules,omitempty"`
+	Direnv      string      `json:"direnv,omitempty"`
+	Divergence  *Divergence `json:"divergence,omitempty"`
+	Warnings    []string    `json:"warnings"`
+	// DryRun is set if nothing was done, the result is what would have been
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type WorktreeManager struct {
+	repo   *GitRepo
+	config *Config
+	// tracer logs the commands that are run with Config.Trace, it is nil
+	// otherwise
+	tracer *tracer
+}
+
+// NewWorktreeManager returns a WorktreeManager for the git repository that
+// contains the current directory. Warnings are logged to stderr unless
+// cfg.Logger is set. With cfg.Trace, the commands that are run are logged too.
+func NewWorktreeManager(cfg Config) *WorktreeManager {
+	if cfg.Logger == nil {
+		cfg.Logger = log.New(os.Stderr, "", 0)
+	}
+	wm := &WorktreeManager{config: &cfg}
+	if cfg.Trace {
+		cfg.Verbose = true
+		wm.tracer = &tracer{logger: cfg.Logger}
+	}
+	wm.config.tracer = wm.tracer
+	return wm
+}
+
+// CreateWorktree creates a worktree for branchname, or reuses an existing one,
+// changes into it, and returns its absolute path. With Config.NoChdir or
+// Config.PrintPath, or if it fails, the current directory is left as it was.
+func (wm *WorktreeManager) CreateWorktree(ctx context.Context, branchname string) (_ string, err error) {
+	start := time.Now()
+	// Only collect the warnings of this call for its result
+	wm.config.warnings = nil
+
+	// initGitRepo changes to the repository root, go back to where we were
+	// called from if anything fails before we change into the worktree, or
+	// if we don't change into it
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	defer func() {
+		if err != nil || !wm.chdir() {
+			os.Chdir(cwd)
+		}
+	}()
+
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return "", err
+	}
+	wm.repo = repo
+
+	// The base and whether to detach are resolved for this call only, the
+	// config is left as given
+	from, detach := wm.config.From, wm.config.Detach
+	if wm.tagRequested(repo, branchname) {
+		from = plumbing.NewTagReferenceName(branchname).String()
+		if !wm.config.AsBranch {
+			// A worktree of a release, not a branch named like it
+			wm.config.statusf(Yellow, "%s is a tag, using a detached worktree at it, pass -as-branch to create a branch instead", branchname)
+			detach = true
+		}
+	}
+
+	if detach {
+		if wm.config.PR > 0 || wm.config.Track || wm.config.NoTrack || wm.config.ForceNewBranch {
+			return "", ErrDetachConflict
+		}
+	} else {
+		if wm.config.PR > 0 {
+			// Pull request branches are named after the pull request, not
+			// the user's prefix
+			if branchname == "" {
+				branchname = prBranchName(wm.config.PR)
+			}
+		} else {
+			branchname = wm.applyBranchPrefix(branchname)
+		}
+		branchname = wm.applyBranchSuffix(branchname, time.Now())
+		if err := validateBranchName(branchname); err != nil {
+			return "", err
+		}
+		if wm.config.ForceNewBranch && repo.branchExistsLocally(branchname) {
+			return "", fmt.Errorf("%w: %s", ErrBranchExists, branchname)
+		}
+	}
+	if wm.config.FromDefault {
+		if from != "" {
+			return "", ErrFromConflict
+		}
+		if from, err = wm.defaultBase(ctx, repo); err != nil {
+			return "", err
+		}
+	}
+
+	baseDir, err := repo.worktreeBaseDir()
+	if err != nil {
+		return "", err
+	}
+	var detachAt plumbing.Hash
+	resolve := func() (string, bool, error) {
+		return repo.resolveWorktreePath(ctx, baseDir, branchname)
+	}
+	if detach {
+		// Without a branch, the name only names the directory, after the
+		// commit unless given
+		if detachAt, err = repo.resolveBase(from, true); err != nil {
+			return "", err
+		}
+		name := branchname
+		if name == "" {
+			name = detachAt.String()[:7]
+		}
+		name = wm.applyBranchSuffix(name, time.Now())
+		branchname = ""
+		resolve = func() (string, bool, error) {
+			return repo.resolveDetachedPath(ctx, baseDir, name)
+		}
+	}
+	worktreePath, existing, err := resolve()
+	if errors.Is(err, ErrWorktreePathExists) && !wm.config.DryRun {
+		// The directory may be a worktree that another invocation is still
+		// adding, look again once it is done
+		unlock, lockErr := repo.lock(ctx)
+		if lockErr != nil {
+			return "", lockErr
+		}
+		worktreePath, existing, err = resolve()
+		unlock()
+	}
+	if err != nil {
+		return "", err
+	}
+	if existing && wm.config.Reset {
+		return "", fmt.Errorf("%w: %s is checked out in %s", ErrResetCheckedOut, branchname, worktreePath)
+	}
+	if existing {
+		if wm.config.DryRun {
+			wm.config.dryRunf("use existing worktree %s", worktreePath)
+			return wm.plannedResult(worktreePath, &CreateResult{Branch: branchname})
+		}
+		return wm.enterWorktree(ctx, worktreePath, "using existing worktree ", &CreateResult{Branch: branchname})
+	}
+
+	var copySource string
+	if wm.config.CopyFrom != "" {
+		copySource, err = wm.resolveCopySource(ctx)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if wm.config.DryRun {
+		if _, err := os.Stat(baseDir); err != nil {
+			wm.config.dryRunf("create directory %s", baseDir)
+		}
+	} else if err := os.MkdirAll(baseDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create worktree base directory: %w", err)
+	}
+
+	pullStart := time.Now()
+	if wm.config.NoPull || repo.bare || !repo.hasRemote {
+		// Branch from the local state as is, a bare repository has nothing
+		// to pull into and without a remote there is nothing to pull from
+	} else if repo.detachedHead() {
+		// A detached HEAD has no branch to pull into, the new branch is
+		// based on the commit as is
+	} else if wm.config.DryRun {
+		wm.config.dryRunf("pull from %s", repo.remote)
+	} else if err := wm.pullWithTimeout(ctx, repo); err != nil {
+		if errors.Is(err, ErrNoUpstream) {
+			// Silent for no upstream - this is common and expected
+		} else if wm.config.Verbose {
+			wm.config.warnf("Unable to pull: %v", err)
+		}
+	}
+	if !wm.config.NoPull && !repo.bare && repo.hasRemote {
+		wm.config.logDuration("pull", pullStart)
+	}
+
+	// A branch pushed since the last fetch would otherwise be created anew
+	// from HEAD instead of from the remote
+	if !wm.config.NoFetch && repo.hasRemote && !wm.config.ForceNewBranch && !detach && wm.config.PR == 0 && (wm.config.Reset || !repo.branchExistsLocally(branchname)) {
+		fetchStart := time.Now()
+		if wm.config.DryRun {
+			wm.config.dryRunf("fetch %s from %s", branchname, repo.remote)
+		} else if err := wm.fetchBranchWithTimeout(ctx, repo, branchname); err != nil && wm.config.Verbose {
+			wm.config.warnf("Unable to fetch %s: %v", branchname, err)
+		}
+		wm.config.logDuration("fetch", fetchStart)
+	}
+	if err := ctx.Err(); err != nil {
+		// Interrupted before anything was created
+		return "", err
+	}
+
+	created, appearedPath, err := wm.addWorktree(ctx, repo, branchname, worktreePath, from, detachAt)
+	if errors.Is(err, errWorktreeAppeared) {
+		return wm.enterWorktree(ctx, appearedPath, "using existing worktree ", &CreateResult{Branch: branchname})
+	}
+	if err != nil {
+		return "", err
+	}
+	result := &CreateResult{
+		Branch:      branchname,
+		Created:     created,
+		Base:        wm.baseName(repo, branchname, created, from, detach),
+		NodeModules: "not copied",
+	}
+	if !wm.config.DryRun {
+		if created {
+			wm.config.Events.branchCreated(repo, branchname)
+		}
+		wm.config.Events.worktreeCreated(branchname, worktreePath)
+	}
+
+	if wm.config.CopyGitConfig {
+		if err := repo.copyGitConfig(ctx, worktreePath); err != nil {
+			wm.config.warnf("Unable to copy git config: %v", err)
+		}
+	}
+
+	if wm.config.CarryChanges {
+		if repo.bare {
+			wm.config.warnf("A bare repository has no changes to carry over")
+		} else if err := repo.carryChanges(ctx, branchname, worktreePath); err != nil {
+			wm.config.warnf("Unable to carry over changes: %v", err)
+		}
+	}
+
+	var copied []string
+	// A bare repository has no working tree to copy untracked files from,
+	// but another worktree has
+	if !wm.config.NoCopy && (!repo.bare || copySource != "") {
+		copyStart := time.Now()
+		fileCopier := &FileCopier{config: wm.config, root: copySource}
+
+		copied, err = fileCopier.copyUntrackedFiles(ctx, branchname, worktreePath)
+		result.Copied = copied
+		result.NodeModules = nodeModulesStatus(copied, fileCopier.hardlinked.Load())
+		if err != nil && ctx.Err() != nil {
+			// The worktree is kept, only the copy is incomplete
+			return worktreePath, err
+		} else if err != nil {
+			wm.config.warnf("Error copying untracked files: %v", err)
+		}
+		if !wm.config.DryRun {
+			wm.config.Events.filesCopied(worktreePath, copied)
+		}
+		wm.config.logDuration("untracked file copy", copyStart)
+	}
+
+	if result.Direnv, err = wm.setupDirenv(worktreePath, copied); err != nil {
+		wm.config.warnf("Error setting up direnv: %v", err)
+	}
+	if err := wm.setupMise(worktreePath, copied); err != nil {
+		wm.config.warnf("Error setting up mise: %v", err)
+	}
+
+	hooksStart := time.Now()
+	if err := wm.runPostCreateHooks(ctx, branchname, worktreePath); err != nil {
+		return worktreePath, err
+	}
+	wm.config.logDuration("post-create hooks", hooksStart)
+
+	// A pull request branch or one created from the remote is already there
+	if wm.config.PushNew && created && wm.config.PR == 0 && !repo.branchExistsOnRemote(branchname) {
+		if err := wm.pushNewBranch(ctx, repo, branchname, worktreePath); err != nil {
+			return worktreePath, err
+		}
+	}
+
+	if wm.config.OpenEditor {
+		if err := wm.openEditor(worktreePath); err != nil {
+			wm.config.warnf("Unable to open editor: %v", err)
+		}
+	}
+	if wm.config.Tmux {
+		if err := wm.openTmuxWindow(ctx, branchname, worktreePath); err != nil {
+			wm.config.warnf("Unable to open tmux window: %v", err)
+		}
+	}
+
+	wm.config.logDuration("total", start)
+
+	if wm.config.DryRun {
+		return wm.plannedResult(worktreePath, result)
+	}
+
+	absPath, err := wm.enterWorktree(ctx, worktreePath, "created worktree ", result)
+	if err == nil {
+		wm.printSummary(result, time.Since(start))
+	}
+	return absPath, err
+}
+
+// resolveCopySource returns the worktree to copy untracked files from for
+// Config.CopyFrom, which is a path or the branch or directory name of a
+// worktree.
+func (wm *WorktreeManager) resolveCopySource(ctx context.Context) (string, error) {
+	if info, err := os.Stat(wm.config.CopyFrom); err == nil && info.IsDir() {
+		return filepath.Abs(wm.config.CopyFrom)
+	}
+
+	worktrees, err := wm.repo.listWorktrees(ctx)
+	if err != nil {
+		return "", err
+	}
+	index, err := wm.repo.findWorktree(worktrees, wm.config.CopyFrom)
+	if err != nil {
+		return "", fmt.Errorf("failed to find worktree to copy from: %w", err)
+	}
+	return worktrees[index].Path, nil
+}
+
+// errWorktreeAppeared is returned by addWorktree if a concurrent invocation
+// created the worktree while it waited for the lock.
+var errWorktreeAppeared = errors.New("worktree was created concurrently")
+
+// addWorktree creates the branch, if needed, from from, and its worktree, or
+// a detached worktree if detachAt is set. Concurrent
+// invocations are serialized by the repository lock, held only for this step
+// so that copying files and running hooks don't block others. If another
+// invocation created the worktree meanwhile, it returns errWorktreeAppeared
+// and the path of that worktree.
+func (wm *WorktreeManager) addWorktree(ctx context.Context, repo *GitRepo, branchname, worktreePath, from string, detachAt plumbing.Hash) (created bool, appearedPath string, err error) {
+	if !wm.config.DryRun {
+		unlock, err := repo.lock(ctx)
+		if err != nil {
+			return false, "", err
+		}
+		defer unlock()
+		if appearedPath, err := wm.recheckWorktreePath(ctx, repo, branchname, worktreePath); err != nil {
+			return false, appearedPath, err
+		}
+	}
+
+	if wm.config.PR > 0 {
+		if created, err = repo.fetchPR(ctx, wm.config.PR, branchname); err != nil {
+			return false, "", err
+		}
+		if created && !wm.config.DryRun {
+			// createWorktree finds the branch already there, so it doesn't
+			// remove it if adding the worktree fails
+			defer func() {
+				if err == nil {
+					return
+				}
+				if removeErr := repo.discardBranch(branchname); removeErr != nil {
+					wm.config.warnf("Unable to remove branch %s: %v", branchname, removeErr)
+				}
+			}()
+		}
+	}
+	if !detachAt.IsZero() {
+		if err := repo.addDetachedWorktree(ctx, worktreePath, detachAt); err != nil {
+			return false, "", fmt.Errorf("%w: %s", ErrWorktreeCreationFailed, err)
+		}
+	} else if wm.config.PR > 0 && wm.config.DryRun {
+		// The branch only exists once the pull request is fetched
+		repo.dryRunWorktreeAdd(branchname, worktreePath)
+	} else {
+		branchCreated, err := repo.createWorktree(ctx, branchname, worktreePath, from)
+		if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+			return false, "", ctxErr
+		}
+		if err != nil {
+			return false, "", fmt.Errorf("%w: %s", ErrWorktreeCreationFailed, err)
+		}
+		created = created || branchCreated
+	}
+	return created, "", nil
+}
+
+// recheckWorktreePath resolves the path of the worktree again once the lock
+// is held, as another invocation may have created a worktree meanwhile. It
+// returns errWorktreeAppeared and the path of the worktree if that is one for
+// branchname, or for a detached HEAD at worktreePath, and an error if
+// worktreePath was taken by anything else.
+func (wm *WorktreeManager) recheckWorktreePath(ctx context.Context, repo *GitRepo, branchname, worktreePath string) (string, error) {
+	if branchname != "" {
+		baseDir, err := repo.worktreeBaseDir()
+		if err != nil {
+			return "", err
+		}
+		path, existing, err := repo.resolveWorktreePath(ctx, baseDir, branchname)
+		switch {
+		case err != nil:
+			return "", err
+		case existing:
+			return path, errWorktreeAppeared
+		case path != worktreePath:
+			return "", fmt.Errorf("%w: %s was taken by another worktree meanwhile", ErrWorktreePathExists, worktreePath)
+		}
+		return "", nil
+	}
+
+	if _, err := os.Lstat(worktreePath); os.IsNotExist(err) {
+		return "", nil
+	}
+	worktrees, err := repo.listWorktrees(ctx)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	for _, wt := range worktrees {
+		if wt.Detached && resolvePath(wt.Path) == resolvePath(absPath) {
+			return wt.Path, errWorktreeAppeared
+		}
+	}
+	return "", repo.checkPathFree(worktrees, worktreePath, "a detached HEAD")
+}
+
+// chdir reports whether CreateWorktree changes into the worktree. A caller
+// printing the path changes into it itself.
+func (wm *WorktreeManager) chdir() bool {
+	return !wm.config.NoChdir && !wm.config.PrintPath
+}
+
+// enterWorktree changes into the worktree, if wanted, reports it in the
+// requested output format, and returns its absolute path.
+func (wm *WorktreeManager) enterWorktree(ctx context.Context, worktreePath, message string, result *CreateResult) (string, error) {
+	// worktreePath may be relative to the repository root, which is the
+	// current directory until we change into the worktree
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	if wm.chdir() {
+		if err := os.Chdir(absPath); err != nil {
+			return "", fmt.Errorf("failed to change to worktree directory: %w", err)
+		}
+	}
+
+	result.Path = absPath
+	// A detached worktree has no branch to compare
+	if result.Branch != "" && (wm.config.JSON || !wm.config.Quiet) {
+		var err error
+		if result.Divergence, err = wm.repo.divergence(ctx, result.Branch); err != nil && wm.config.Verbose {
+			wm.config.warnf("Unable to compare %s with its base: %v", result.Branch, err)
+		}
+	}
+
+	if wm.config.JSON {
+		return absPath, wm.printResult(result)
+	}
+
+	wm.config.statusf(Green, "%s%s", message, worktreePath)
+	if d := result.Divergence; d != nil {
+		wm.config.statusf(Green, "branch %s is %d ahead, %d behind %s", result.Branch, d.Ahead, d.Behind, d.Base)
+	}
+	if wm.config.PrintPath {
+		fmt.Println(absPath)
+	}
+	return absPath, nil
+}
+
+// plannedResult prints the result of a dry run as JSON with Config.JSON, with
+// the path the worktree would have, and returns that path.
+func (wm *WorktreeManager) plannedResult(worktreePath string, result *CreateResult) (string, error) {
+	if !wm.config.JSON {
+		return worktreePath, nil
+	}
+	result.Path = worktreePath
+	result.DryRun = true
+	return worktreePath, wm.printResult(result)
+}
+
+// printResult prints result as JSON, with the warnings collected so far.
+func (wm *WorktreeManager) printResult(result *CreateResult) error {
+	if absPath, err := filepath.Abs(result.Path); err == nil {
+		result.Path = absPath
+	}
+	result.Warnings = wm.config.warnings
+	if result.Copied == nil {
+		result.Copied = []string{}
+	}
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(result)
+}
+
+const defaultPullTimeout = 30 * time.Second
+
+func (wm *WorktreeManager) pullWithTimeout(ctx context.Context, repo *GitRepo) error {
+	timeout := wm.pullTimeout()
+	pullCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	retries := wm.pullRetries()
+	backoff := initialPullBackoff
+	err := repo.pull(pullCtx)
+	for attempt := 1; attempt <= retries && isTransientError(err); attempt++ {
+		if wm.config.Verbose {
+			wm.config.Logger.Printf("pull failed: %v, retrying in %s (%d/%d)", err, backoff, attempt, retries)
+		}
+		select {
+		case <-pullCtx.Done():
+		case <-time.After(backoff):
+			err = repo.pull(pullCtx)
+			backoff *= 2
+			continue
+		}
+		break
+	}
+	if err != nil && errors.Is(pullCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("pull timed out after %s", timeout)
+	}
+	return err
+}
+
+// tagRequested reports whether name is a tag to create the worktree at,
+// rather than a branch: there is no branch of that name, locally or on the
+// remote, and no flag asks for a branch or a different base.
+func (wm *WorktreeManager) tagRequested(repo *GitRepo, name string) bool {
+	if name == "" || wm.config.Detach || wm.config.PR > 0 || wm.config.From != "" || wm.config.FromDefault ||
+		wm.config.ForceNewBranch || wm.config.Track || wm.config.NoTrack {
+		return false
+	}
+	if _, err := repo.repository.Reference(plumbing.NewTagReferenceName(name), false); err != nil {
+		return false
+	}
+	return !repo.branchExistsLocally(name) && !repo.branchExistsOnRemote(name)
+}
+
+// defaultBase fetches the default branch and returns the ref of its tip, to
+// base new branches on instead of HEAD.
+func (wm *WorktreeManager) defaultBase(ctx context.Context, repo *GitRepo) (string, error) {
+	branch, err := repo.defaultBranch()
+	if err != nil {
+		return "", err
+	}
+	if !wm.config.NoFetch && repo.hasRemote {
+		if wm.config.DryRun {
+			wm.config.dryRunf("fetch %s from %s", branch, repo.remote)
+		} else if err := wm.fetchBranchWithTimeout(ctx, repo, branch); err != nil {
+			wm.config.warnf("Unable to fetch %s, using the last fetched state: %v", branch, err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	switch {
+	case repo.branchExistsOnRemote(branch):
+		return plumbing.NewRemoteReferenceName(repo.remote, branch).String(), nil
+	case repo.branchExistsLocally(branch):
+		return plumbing.NewBranchReferenceName(branch).String(), nil
+	default:
+		return "", fmt.Errorf("%w: %s doesn't exist", ErrNoDefaultBranch, branch)
+	}
+}
+
+// pushNewBranch publishes a branch created for Config.PushNew to the remote,
+// giving up after the pull timeout. The worktree is kept if it fails.
+func (wm *WorktreeManager) pushNewBranch(ctx context.Context, repo *GitRepo, branchname, worktreePath string) error {
+	if !repo.hasRemote {
+		wm.config.warnf("No %s remote to push %s to", repo.remote, branchname)
+		return nil
+	}
+	if wm.config.DryRun {
+		wm.config.dryRunf("push %s to %s and track it", branchname, repo.remote)
+		return nil
+	}
+
+	pushStart := time.Now()
+	timeout := wm.pullTimeout()
+	pushCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := repo.pushBranch(pushCtx, branchname)
+	if err != nil && errors.Is(pushCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("push timed out after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%w %s to %s: %v (worktree kept at %s)", ErrPushFailed, branchname, repo.remote, err, worktreePath)
+	}
+	wm.config.logDuration("push", pushStart)
+	wm.config.statusf(Green, "pushed %s to %s", branchname, repo.remote)
+	return nil
+}
+
+const initialPullBackoff = time.Second
+
+// fetchBranchWithTimeout fetches branchname, giving up after the pull timeout.
+func (wm *WorktreeManager) fetchBranchWithTimeout(ctx context.Context, repo *GitRepo, branchname string) error {
+	timeout := wm.pullTimeout()
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := repo.fetchBranch(fetchCtx, branchname)
+	if err != nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("fetch timed out after %s", timeout)
+	}
+	return err
+}
+
+// pullRetries returns how often a pull that failed with a transient network
+// error is retried, from worktree.pullretries. The default is not to retry.
+func (wm *WorktreeManager) pullRetries() int {
+	value := wm.config.configValue("worktree.pullretries")
+	if value == "" {
+		return 0
+	}
+	retries, err := strconv.Atoi(value)
+	if err != nil || retries < 0 {
+		wm.config.warnf("Invalid worktree.pullretries %q, not retrying", value)
+		return 0
+	}
+	return retries
+}
+
+// pullTimeout returns Config.PullTimeout, then worktree.pulltimeout, then the
+// default. The git config value is a duration such as "1m" or a number of
+// seconds.
+func (wm *WorktreeManager) pullTimeout() time.Duration {
+	if wm.config.PullTimeout > 0 {
+		return wm.config.PullTimeout
+	}
+
+	value := wm.config.configValue("worktree.pulltimeout")
+	if value == "" {
+		return defaultPullTimeout
+	}
+	if timeout, err := time.ParseDuration(value); err == nil && timeout > 0 {
+		return timeout
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	wm.config.warnf("Invalid worktree.pulltimeout %q, using %s", value, defaultPullTimeout)
+	return defaultPullTimeout
+}
+
+// shouldTrack reports whether a new branch should track the remote. By default
+// only branches created from a remote branch do.
+func (c *Config) shouldTrack(fromRemote bool) bool {
+	switch {
+	case c.NoTrack:
+		return false
+	case c.Track:
+		return true
+	default:
+		return fromRemote
+	}
+}
+
+// logDuration logs how long a phase took since start in verbose mode.
+func (c *Config) logDuration(phase string, start time.Time) {
+	if c.Verbose {
+		c.Logger.Printf("%s took %s", phase, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// applyBranchPrefix prepends worktree.branchprefix to branchname unless it is
+// disabled or the name already starts with it. An existing branch, such as
+// one picked from the list or completed, is kept as is, unless the prefixed
+// name exists as well.
+func (wm *WorktreeManager) applyBranchPrefix(branchname string) string {
+	if wm.config.NoPrefix {
+		return branchname
+	}
+	prefix := wm.config.configValue("worktree.branchprefix")
+	if prefix == "" || strings.HasPrefix(branchname, prefix) {
+		return branchname
+	}
+	exists := func(name string) bool {
+		return wm.repo.branchExistsLocally(name) || wm.repo.branchExistsOnRemote(name)
+	}
+	if exists(branchname) && !exists(prefix+branchname) {
+		return branchname
+	}
+	return prefix + branchname
+}
+
+// applyBranchSuffix appends -suffix and then a -timestamp, if set, to
+// branchname, so that throwaway worktrees get unique names.
+func (wm *WorktreeManager) applyBranchSuffix(branchname string, now time.Time) string {
+	if wm.config.Suffix != "" {
+		branchname += "-" + wm.config.Suffix
+	}
+	if wm.config.Timestamp {
+		branchname += "-" + now.Format("20060102-150405")
+	}
+	return branchname
+}
+
+func worktreeDirName(branchname string) string {
+	return strings.ReplaceAll(branchname, "/", "_")
+}
+
+// setupDirenv allows the copied .envrc with direnv, if direnv is installed,
+// and returns what it did for the summary.
+func (wm *WorktreeManager) setupDirenv(worktreePath string, copied []string) (string, error) {
+	if !hasCommand("direnv") {
+		return "not installed", nil
+	}
+	if wm.config.DryRun {
+		if _, err := os.Stat(".envrc"); err == nil && !wm.config.NoCopy {
+			wm.config.dryRunf("direnv allow %s", worktreePath)
+		}
+		return "", nil
+	}
+	if !slices.Contains(copied, ".envrc") {
+		return "no .envrc copied", nil
+	}
+	if err := wm.tracer.command("direnv", "allow", worktreePath).Run(); err != nil {
+		return "allow failed", err
+	}
+	return "allowed", nil
+}
+
+var miseConfigFiles = []string{"mise.toml", ".mise.toml"}
+
+// setupMise trusts the copied mise config files, if mise is installed.
+func (wm *WorktreeManager) setupMise(worktreePath string, copied []string) error {
+	if !hasCommand("mise") {
+		return nil
+	}
+	for _, file := range miseConfigFiles {
+		configPath := filepath.Join(worktreePath, file)
+		if wm.config.DryRun {
+			if _, err := os.Stat(file); err == nil && !wm.config.NoCopy {
+				wm.config.dryRunf("mise trust %s", configPath)
+			}
+			continue
+		}
+		if !slices.Contains(copied, file) {
+			continue
+		}
+		if err := wm.tracer.command("mise", "trust", configPath).Run(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package worktree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newStalledRemote returns the URL of a remote that accepts connections but
+// never responds.
+func newStalledRemote(t *testing.T) string {
+	t.Helper()
+	for _, name := range []string{"HTTP_PROXY", "http_proxy", "HTTPS_PROXY", "https_proxy", "ALL_PROXY", "all_proxy"} {
+		t.Setenv(name, "")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+	return "http://" + listener.Addr().String() + "/repo.git"
+}
+
+// newStalledRepo returns a repository on main, tracking main of a stalled
+// remote.
+func newStalledRepo(t *testing.T) string {
+	t.Helper()
+	remoteURL := newStalledRemote(t)
+	dir := newTestRepo(t)
+	run(t, dir, "git", "checkout", "-q", "-b", "main")
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "initial")
+	run(t, dir, "git", "remote", "add", "origin", remoteURL)
+	run(t, dir, "git", "config", "branch.main.remote", "origin")
+	run(t, dir, "git", "config", "branch.main.merge", "refs/heads/main")
+	return dir
+}
+
+func TestPullWithTimeoutStalledRemote(t *testing.T) {
+	newStalledRepo(t)
+	wm := NewWorktreeManager(Config{PullTimeout: 200 * time.Millisecond, Quiet: true, Logger: log.New(io.Discard, "", 0)})
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = wm.pullWithTimeout(context.Background(), repo)
+	if err == nil || !strings.Contains(err.Error(), "pull timed out after 200ms") {
+		t.Errorf("pullWithTimeout = %v, want it to time out", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("pullWithTimeout took %s", elapsed)
+	}
+}
+
+func TestCreateWorktreeStalledRemote(t *testing.T) {
+	dir := newStalledRepo(t)
+	var output bytes.Buffer
+	wm := NewWorktreeManager(Config{PullTimeout: 200 * time.Millisecond, NoCopy: true, NoChdir: true, Verbose: true, Logger: log.New(&output, "", 0)})
+
+	path, err := wm.CreateWorktree(context.Background(), "feature")
+	if err != nil {
+		t.Fatalf("CreateWorktree = %v, want the pull timeout to be ignored", err)
+	}
+	if !strings.Contains(output.String(), "pull timed out") {
+		t.Errorf("no warning about the pull timeout:\n%s", output.String())
+	}
+
+	// The worktree is complete, and no other one was left behind
+	if head := run(t, path, "git", "rev-parse", "--abbrev-ref", "HEAD"); head != "feature" {
+		t.Errorf("worktree HEAD = %q, want feature", head)
+	}
+	if list := run(t, dir, "git", "worktree", "list", "--porcelain"); strings.Count(list, "worktree ") != 2 {
+		t.Errorf("git worktree list:\n%s", list)
+	}
+	if matches, _ := filepath.Glob(path + "*"); len(matches) != 1 {
+		t.Errorf("worktree directories = %q, want only %s", matches, path)
+	}
+}
+
+func TestCreateWorktreeReadyWhenReported(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake direnv is a shell script")
+	}
+	dir := newTestRepo(t)
+	run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "initial")
+	run(t, dir, "git", "config", "worktree.excludedirs", ".git")
+	writeFiles(t, dir, ".env", ".envrc", "config/local.yml", "node_modules/dep/index.js")
+
+	// direnv allow leaves a file in the worktree to show it ran
+	bin := t.TempDir()
+	direnv := "#!/bin/sh\ntouch \"$2/.direnv-allowed\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "direnv"), []byte(direnv), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// Check the worktree as soon as it is reported as created on stdout
+	path := filepath.Join(filepath.Dir(dir), "feature")
+	want := []string{".env", ".envrc", "config/local.yml", "node_modules/dep/index.js", ".direnv-allowed"}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = stdout })
+	var missing []string
+	reported := make(chan bool)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		found := false
+		for scanner.Scan() {
+			if !found && strings.HasPrefix(scanner.Text(), "created worktree") {
+				found = true
+				for _, file := range want {
+					if _, err := os.Stat(filepath.Join(path, file)); err != nil {
+						missing = append(missing, file)
+					}
+				}
+			}
+		}
+		reported <- found
+	}()
+
+	wm := NewWorktreeManager(Config{
+		CopyPatterns: []string{".env", ".envrc", "config/*.yml", "node_modules/"},
+		NoChdir:      true,
+		Logger:       log.New(io.Discard, "", 0),
+	})
+	created, err := wm.CreateWorktree(context.Background(), "feature")
+	os.Stdout = stdout
+	w.Close()
+	if !<-reported {
+		t.Error("the worktree wasn't reported as created")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != path {
+		t.Errorf("CreateWorktree = %s, want %s", created, path)
+	}
+	if len(missing) > 0 {
+		t.Errorf("%q missing when the worktree was reported as created", missing)
+	}
+}
@@ -0,0 +1,61 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ErrMoveMainWorktree = errors.New("refusing to move the main worktree")
+
+// MoveWorktree moves the worktree of branchname to newPath, which must not
+// exist yet.
+func (wm *WorktreeManager) MoveWorktree(ctx context.Context, branchname, newPath string) error {
+	// Resolve newPath before initGitRepo changes to the repository root
+	newPath, err := filepath.Abs(newPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve destination path: %w", err)
+	}
+
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return err
+	}
+	wm.repo = repo
+
+	worktrees, err := repo.listWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+
+	index, err := repo.findWorktree(worktrees, branchname)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		return ErrMoveMainWorktree
+	}
+	target := worktrees[index]
+
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrWorktreePathExists, newPath)
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to check destination path: %w", err)
+	}
+
+	if wm.config.DryRun {
+		wm.config.dryRunf("git worktree move %s %s", target.Path, newPath)
+		return nil
+	}
+
+	cmd := wm.tracer.commandContext(ctx, "git", "worktree", "move", target.Path, newPath)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to move worktree %s: %w", target.Path, err)
+	}
+	wm.config.statusf(Green, "moved worktree %s to %s", target.Path, newPath)
+
+	return nil
+}
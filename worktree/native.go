@@ -0,0 +1,146 @@
+package worktree
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// addWorktreeNative does what git worktree add does with go-git: it registers
+// worktreePath as a linked worktree in the repository's worktrees directory
+// and checks out branchname into it. Unlike git, it runs no hooks and no
+// filters such as Git LFS. If it fails, nothing is left behind.
+func (r *GitRepo) addWorktreeNative(branchname, worktreePath string) (err error) {
+	commonDir, err := r.commonDir()
+	if err != nil {
+		return err
+	}
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	if _, err := os.Lstat(absPath); err == nil {
+		return fmt.Errorf("%w: %s", ErrWorktreePathExists, absPath)
+	}
+
+	adminDir, err := createAdminDir(commonDir, filepath.Base(absPath))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(adminDir)
+			os.RemoveAll(absPath)
+		}
+	}()
+
+	if err := os.MkdirAll(absPath, 0755); err != nil {
+		return fmt.Errorf("failed to create worktree directory: %w", err)
+	}
+
+	// The same files git writes, commondir is relative to the admin directory
+	files := []struct{ path, content string }{
+		{filepath.Join(adminDir, "gitdir"), filepath.Join(absPath, ".git")},
+		{filepath.Join(adminDir, "commondir"), filepath.Join("..", "..")},
+		{filepath.Join(adminDir, "HEAD"), "ref: " + plumbing.NewBranchReferenceName(branchname).String()},
+		{filepath.Join(absPath, ".git"), "gitdir: " + adminDir},
+	}
+	for _, file := range files {
+		if err := os.WriteFile(file.path, []byte(file.content+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.path, err)
+		}
+	}
+
+	repo, err := git.PlainOpenWithOptions(absPath, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return fmt.Errorf("failed to open new worktree: %w", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return fmt.Errorf("failed to get new worktree: %w", err)
+	}
+	err = w.Checkout(&git.CheckoutOptions{
+		Branch: plumbing.NewBranchReferenceName(branchname),
+		Force:  true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check out %s: %w", branchname, err)
+	}
+	return nil
+}
+
+// commonDir returns the git directory shared by all worktrees of the
+// repository, which holds the objects, refs, and the worktrees directory.
+func (r *GitRepo) commonDir() (string, error) {
+	if r.bare {
+		return r.root, nil
+	}
+
+	dotGit := filepath.Join(r.root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil {
+		return "", fmt.Errorf("failed to find git directory: %w", err)
+	}
+	if info.IsDir() {
+		return dotGit, nil
+	}
+
+	// The repository root is itself a linked worktree, follow its .git file
+	// to its admin directory and from there to the common directory
+	gitDir, err := readGitFile(dotGit, "gitdir: ")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(r.root, gitDir)
+	}
+	commonDir, err := readGitFile(filepath.Join(gitDir, "commondir"), "")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(gitDir, commonDir)
+	}
+	return filepath.Clean(commonDir), nil
+}
+
+func readGitFile(path, prefix string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	value, ok := strings.CutPrefix(strings.TrimSpace(string(data)), prefix)
+	if !ok {
+		return "", fmt.Errorf("unexpected content in %s", path)
+	}
+	return value, nil
+}
+
+// createAdminDir creates the directory for a new worktree in the worktrees
+// directory, numbering it like git if name is taken.
+func createAdminDir(commonDir, name string) (string, error) {
+	worktreesDir := filepath.Join(commonDir, "worktrees")
+	if err := os.MkdirAll(worktreesDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", worktreesDir, err)
+	}
+
+	for i := 0; ; i++ {
+		adminDir := filepath.Join(worktreesDir, name)
+		if i > 0 {
+			adminDir += strconv.Itoa(i)
+		}
+		err := os.Mkdir(adminDir, 0755)
+		if err == nil {
+			return adminDir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("failed to create %s: %w", adminDir, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+var ErrAmbiguousWorktree = errors.New("more than one worktree matches")
+
+// OpenWorktree looks up the existing worktree for name, a branch name or
+// worktree directory name, and returns its path. With JSON or PrintPath set,
+// the path is printed. Otherwise a shell is started in the worktree, and
+// OpenWorktree returns once it exits.
+func (wm *WorktreeManager) OpenWorktree(ctx context.Context, name string) (string, error) {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return "", err
+	}
+	wm.repo = repo
+
+	worktrees, err := repo.listWorktrees(ctx)
+	if err != nil {
+		return "", err
+	}
+	index, err := repo.findWorktree(worktrees, name)
+	if err != nil {
+		return "", err
+	}
+	target := worktrees[index]
+
+	if wm.config.JSON {
+		return target.Path, wm.printResult(&CreateResult{Branch: target.Branch, Path: target.Path})
+	}
+	if wm.config.PrintPath {
+		fmt.Println(target.Path)
+		return target.Path, nil
+	}
+
+	wm.config.statusf(Green, "opening a shell in %s, exit it to return", target.Path)
+	shell := wm.tracer.commandContext(ctx, userShell())
+	shell.Dir = target.Path
+	shell.Stdin = os.Stdin
+	shell.Stdout = os.Stdout
+	shell.Stderr = os.Stderr
+	if err := shell.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return "", fmt.Errorf("failed to start shell: %w", err)
+		}
+		// The exit status of the last command run in the shell isn't ours
+	}
+	return target.Path, nil
+}
+
+// findWorktree returns the index in worktrees of the worktree for name. The
+// branch is looked up first, then the directory the branch name maps to, and
+// then any worktree directory with that name.
+func (r *GitRepo) findWorktree(worktrees []WorktreeInfo, name string) (int, error) {
+	for i, wt := range worktrees {
+		if wt.Branch == name {
+			return i, nil
+		}
+	}
+
+	// The directory may not be the plain mapping of the branch name if that
+	// was already taken, so this only comes after the branch lookup
+	baseDir, err := r.worktreeBaseDir()
+	if err != nil {
+		return -1, err
+	}
+	dirname, err := r.worktreeDir(name)
+	if err != nil {
+		return -1, err
+	}
+	worktreePath, err := filepath.Abs(filepath.Join(baseDir, dirname))
+	if err != nil {
+		return -1, fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	expected := resolvePath(worktreePath)
+	for i, wt := range worktrees {
+		if resolvePath(wt.Path) == expected {
+			return i, nil
+		}
+	}
+
+	var matches []int
+	for i, wt := range worktrees {
+		if filepath.Base(wt.Path) == worktreeDirName(name) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("%w: %s", ErrWorktreeNotFound, name)
+	case 1:
+		return matches[0], nil
+	default:
+		paths := make([]string, 0, len(matches))
+		for _, i := range matches {
+			paths = append(paths, worktrees[i].Path)
+		}
+		return -1, fmt.Errorf("%w %s: %s", ErrAmbiguousWorktree, name, strings.Join(paths, ", "))
+	}
+}
+
+func userShell() string {
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	if runtime.GOOS == "windows" {
+		if shell := os.Getenv("COMSPEC"); shell != "" {
+			return shell
+		}
+		return "cmd"
+	}
+	return "sh"
+}
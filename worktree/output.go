@@ -0,0 +1,72 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/muesli/termenv"
+)
+
+// Color is a foreground color for messages.
+type Color string
+
+const (
+	Red    Color = "#FF005F"
+	Green  Color = "#00FF00"
+	Yellow Color = "#FFFF00"
+)
+
+// Paint returns s in color for writing to out. It stays plain if out is not a
+// terminal, NO_COLOR is set, or Config.NoColor is.
+func (c *Config) Paint(out *os.File, color Color, s string) string {
+	profile := termenv.Ascii
+	if !c.NoColor {
+		profile = termenv.NewOutput(out).EnvColorProfile()
+	}
+	return termenv.String(s).Foreground(profile.Color(string(color))).String()
+}
+
+// machineOutput reports whether stdout is reserved for output meant to be
+// parsed, in which case everything else goes to stderr.
+func (c *Config) machineOutput() bool {
+	return c.JSON || c.PrintPath
+}
+
+// warnf prints a non-fatal warning, or records it for the JSON output.
+// Warnings are not printed in quiet mode.
+func (c *Config) warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if c.JSON {
+		c.warnings = append(c.warnings, msg)
+		return
+	}
+	if c.Quiet {
+		return
+	}
+	c.log(Yellow, msg)
+}
+
+// log writes msg to Config.Logger, in color if it writes to a terminal.
+func (c *Config) log(color Color, msg string) {
+	if out, ok := c.Logger.Writer().(*os.File); ok {
+		msg = c.Paint(out, color, msg)
+	}
+	c.Logger.Print(msg)
+}
+
+// statusf prints an informational message in color, on stderr if stdout is
+// reserved for machine output. Nothing is printed in quiet mode.
+func (c *Config) statusf(color Color, format string, args ...any) {
+	if c.Quiet {
+		return
+	}
+	out := os.Stdout
+	if c.machineOutput() {
+		out = os.Stderr
+	}
+	fmt.Fprintf(out, "%s\n", c.Paint(out, color, fmt.Sprintf(format, args...)))
+}
+
+func (c *Config) dryRunf(format string, args ...any) {
+	c.log(Yellow, "[dry-run] "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,143 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+)
+
+var (
+	ErrUnknownForge     = errors.New("remote is not on GitHub or GitLab, can't fetch pull requests")
+	ErrPRNotFound       = errors.New("pull request not found")
+	ErrPRBranchDiverged = errors.New("the local branch has commits that are not in the pull request")
+)
+
+func prBranchName(number int) string {
+	return fmt.Sprintf("pr/%d", number)
+}
+
+// prRef returns the ref the remote's forge publishes the head of pull request
+// number under.
+func prRef(remoteURL string, number int) (string, error) {
+	// Parsed the way go-git will, whatever the protocol and port
+	var host string
+	if endpoint, err := transport.NewEndpoint(remoteURL); err == nil {
+		host = endpoint.Host
+	}
+
+	switch {
+	case strings.Contains(host, "github"):
+		return fmt.Sprintf("refs/pull/%d/head", number), nil
+	case strings.Contains(host, "gitlab"):
+		return fmt.Sprintf("refs/merge-requests/%d/head", number), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownForge, remoteURL)
+	}
+}
+
+// fetchPR fetches the head of pull request number into the local branch
+// branchname, and reports whether the branch was created. An existing branch
+// is only fast-forwarded, if it has commits that are not in the pull request,
+// such as a reviewer's fixups, it returns ErrPRBranchDiverged and leaves it
+// as it is.
+func (r *GitRepo) fetchPR(ctx context.Context, number int, branchname string) (bool, error) {
+	if !r.hasRemote {
+		return false, fmt.Errorf("%w: %s", ErrRemoteNotFound, r.remote)
+	}
+	remoteURL, err := r.remoteURL()
+	if err != nil {
+		return false, err
+	}
+	ref, err := prRef(remoteURL, number)
+	if err != nil {
+		return false, err
+	}
+	created := !r.branchExistsLocally(branchname)
+
+	// Fetched to a ref of its own first, the branch is only updated once it
+	// is known not to lose anything
+	fetched := plumbing.ReferenceName(fmt.Sprintf("refs/worktree-tool/pr/%d", number))
+	refSpec := config.RefSpec(fmt.Sprintf("+%s:%s", ref, fetched))
+	if r.config.DryRun {
+		r.config.dryRunf("fetch %s from %s into %s", ref, r.remote, branchname)
+		return created, nil
+	}
+
+	auth, err := r.getAuth()
+	if err != nil {
+		return false, fmt.Errorf("failed to get authentication: %w", err)
+	}
+	caBundle, proxy, err := r.httpOptions()
+	if err != nil {
+		return false, err
+	}
+	err = r.repository.FetchContext(ctx, &git.FetchOptions{
+		RemoteName:   r.remote,
+		RefSpecs:     []config.RefSpec{refSpec},
+		Auth:         auth,
+		Progress:     r.getProgressWriter(),
+		CABundle:     caBundle,
+		ProxyOptions: proxy,
+	})
+	switch {
+	case err == nil, errors.Is(err, git.NoErrAlreadyUpToDate):
+	case errors.Is(err, git.NoMatchingRefSpecError{}):
+		return false, fmt.Errorf("%w: #%d on %s", ErrPRNotFound, number, r.remote)
+	default:
+		return false, r.remoteError(err)
+	}
+	defer r.repository.Storer.RemoveReference(fetched)
+
+	head, err := r.repository.Reference(fetched, true)
+	if err != nil {
+		return false, fmt.Errorf("failed to read the fetched pull request: %w", err)
+	}
+	err = r.fastForward(branchname, head.Hash())
+	if errors.Is(err, ErrPRBranchDiverged) {
+		return false, fmt.Errorf("%w: %s isn't an ancestor of #%d at %s, push or drop its commits, or pass another branch name", err, branchname, number, head.Hash().String()[:7])
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update %s: %w", branchname, err)
+	}
+	return created, nil
+}
+
+// fastForward points the local branch branchname at hash, creating it if
+// needed. An existing branch must be an ancestor of hash, so that no commits
+// are lost, it returns ErrPRBranchDiverged otherwise.
+func (r *GitRepo) fastForward(branchname string, hash plumbing.Hash) error {
+	name := plumbing.NewBranchReferenceName(branchname)
+	local, err := r.repository.Reference(name, true)
+	if errors.Is(err, plumbing.ErrReferenceNotFound) {
+		return r.repository.Storer.SetReference(plumbing.NewHashReference(name, hash))
+	}
+	if err != nil {
+		return err
+	}
+	if local.Hash() == hash {
+		return nil
+	}
+
+	localCommit, err := r.repository.CommitObject(local.Hash())
+	if err != nil {
+		return err
+	}
+	headCommit, err := r.repository.CommitObject(hash)
+	if err != nil {
+		return err
+	}
+	ancestor, err := localCommit.IsAncestor(headCommit)
+	if err != nil {
+		return err
+	}
+	if !ancestor {
+		return ErrPRBranchDiverged
+	}
+	return r.repository.Storer.CheckAndSetReference(plumbing.NewHashReference(name, hash), local)
+}
@@ -0,0 +1,189 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestFastForward(t *testing.T) {
+	h := newTestHistory(t)
+	base := h.commit()
+	head := h.commit(base)
+	fixup := h.commit(base)
+	repo := &GitRepo{repository: h.repo}
+
+	tests := []struct {
+		name    string
+		local   plumbing.Hash // zero if the branch doesn't exist
+		want    plumbing.Hash
+		wantErr error
+	}{
+		{name: "new branch", want: head},
+		{name: "up to date", local: head, want: head},
+		{name: "behind", local: base, want: head},
+		{name: "diverged", local: fixup, want: fixup, wantErr: ErrPRBranchDiverged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := plumbing.NewBranchReferenceName("pr/1")
+			repo.repository.Storer.RemoveReference(name)
+			if !tt.local.IsZero() {
+				if err := repo.repository.Storer.SetReference(plumbing.NewHashReference(name, tt.local)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := repo.fastForward("pr/1", head)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("fastForward = %v, want %v", err, tt.wantErr)
+			}
+			ref, err := repo.repository.Reference(name, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ref.Hash() != tt.want {
+				t.Errorf("pr/1 is at %s, want %s", ref.Hash(), tt.want)
+			}
+		})
+	}
+}
+
+// newPRRemote serves a repository on a fake GitHub host, through a proxy set
+// in the environment, with a pull request #12 one commit ahead of main. It
+// returns the URL of the repository.
+func newPRRemote(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	run(t, "", "git", "init", "-q", "-b", "main", work)
+	run(t, work, "git", "commit", "-q", "--allow-empty", "-m", "base")
+	run(t, work, "git", "commit", "-q", "--allow-empty", "-m", "pull request")
+	run(t, "", "git", "clone", "-q", "--bare", work, filepath.Join(root, "repo.git"))
+	run(t, filepath.Join(root, "repo.git"), "git", "update-ref", "refs/pull/12/head", "main")
+	run(t, filepath.Join(root, "repo.git"), "git", "update-ref", "refs/heads/main", "main~1")
+
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(server.Close)
+	// git reads the lower case variable
+	for _, key := range []string{"HTTP_PROXY", "http_proxy"} {
+		t.Setenv(key, server.URL)
+	}
+	for _, key := range []string{"NO_PROXY", "no_proxy"} {
+		t.Setenv(key, "")
+	}
+	return "http://github.test/repo.git"
+}
+
+// run runs the command in dir, and fails the test if it fails.
+func run(t *testing.T, dir, name string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s %s: %v: %s", name, strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestFetchPR(t *testing.T) {
+	tests := []struct {
+		name string
+		// local is the commit pr/12 is at before, relative to main, or
+		// empty if it doesn't exist
+		local   string
+		created bool
+		wantErr error
+	}{
+		{name: "new branch", created: true},
+		{name: "behind", local: "main"},
+		{name: "diverged", local: "fixup", wantErr: ErrPRBranchDiverged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remoteURL := newPRRemote(t)
+			dir := newTestRepo(t)
+			run(t, dir, "git", "remote", "add", "origin", remoteURL)
+			run(t, dir, "git", "fetch", "-q", "origin", "main")
+			run(t, dir, "git", "checkout", "-q", "-b", "main", "origin/main")
+			var before string
+			switch tt.local {
+			case "main":
+				run(t, dir, "git", "branch", "pr/12", "main")
+			case "fixup":
+				run(t, dir, "git", "checkout", "-q", "-b", "pr/12")
+				run(t, dir, "git", "commit", "-q", "--allow-empty", "-m", "fixup")
+				run(t, dir, "git", "checkout", "-q", "main")
+			}
+			if tt.local != "" {
+				before = run(t, dir, "git", "rev-parse", "pr/12")
+			}
+
+			wm := NewWorktreeManager(Config{Quiet: true, Logger: log.New(io.Discard, "", 0)})
+			repo, err := wm.initGitRepo()
+			if err != nil {
+				t.Fatal(err)
+			}
+			created, err := repo.fetchPR(context.Background(), 12, "pr/12")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("fetchPR = %v, want %v", err, tt.wantErr)
+			}
+			if created != tt.created {
+				t.Errorf("fetchPR created = %v, want %v", created, tt.created)
+			}
+
+			after := run(t, dir, "git", "rev-parse", "pr/12")
+			want, _, _ := strings.Cut(run(t, dir, "git", "ls-remote", "origin", "refs/pull/12/head"), "\t")
+			if tt.wantErr != nil {
+				want = before
+			}
+			if after != want {
+				t.Errorf("pr/12 is at %s, want %s", after, want)
+			}
+			if refs := run(t, dir, "git", "for-each-ref", "refs/worktree-tool"); refs != "" {
+				t.Errorf("fetched ref left behind: %s", refs)
+			}
+		})
+	}
+}
+
+func TestCreateWorktreePRRemovesBranchOnFailure(t *testing.T) {
+	remoteURL := newPRRemote(t)
+	dir := newTestRepo(t)
+	run(t, dir, "git", "remote", "add", "origin", remoteURL)
+	run(t, dir, "git", "fetch", "-q", "origin", "main")
+	run(t, dir, "git", "checkout", "-q", "-b", "main", "origin/main")
+	// git worktree add fails once the checkout hook does
+	hook := filepath.Join(dir, ".git", "hooks", "post-checkout")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	wm := NewWorktreeManager(Config{PR: 12, NoCopy: true, NoChdir: true, Quiet: true, Logger: log.New(io.Discard, "", 0)})
+	if _, err := wm.CreateWorktree(context.Background(), ""); !errors.Is(err, ErrWorktreeCreationFailed) {
+		t.Fatalf("CreateWorktree = %v, want ErrWorktreeCreationFailed", err)
+	}
+	if branches := run(t, dir, "git", "branch", "--list", "pr/12"); branches != "" {
+		t.Errorf("pr/12 left behind: %s", branches)
+	}
+}
@@ -0,0 +1,116 @@
+package worktree
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+func (wm *WorktreeManager) PruneWorktrees(ctx context.Context) error {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return err
+	}
+	wm.repo = repo
+
+	pruned, err := repo.pruneWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+	for _, entry := range pruned {
+		wm.config.statusf(Yellow, "pruned %s", entry)
+	}
+
+	removed := 0
+	if wm.config.Gone {
+		removed, err = wm.removeGoneWorktrees(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	wm.config.statusf(Green, "pruned %d stale entries, removed %d worktrees", len(pruned), removed)
+	return nil
+}
+
+// removeGoneWorktrees offers to remove worktrees whose upstream branch no
+// longer exists on the remote.
+func (wm *WorktreeManager) removeGoneWorktrees(ctx context.Context) (int, error) {
+	repo := wm.repo
+
+	// Drop remote-tracking refs for deleted branches so they are detected
+	if repo.hasRemote {
+		fetch := wm.tracer.commandContext(ctx, "git", "fetch", "--prune", repo.remote)
+		if err := fetch.Run(); err != nil && wm.config.Verbose {
+			wm.config.warnf("Unable to fetch: %v", err)
+		}
+	}
+
+	worktrees, err := repo.listWorktrees(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	removed := 0
+	// The first entry is the main worktree, which is never removed
+	for _, wt := range worktrees[min(1, len(worktrees)):] {
+		if wt.Branch == "" {
+			continue
+		}
+		upstream := repo.upstreamBranch(ctx, wt.Branch)
+		if upstream == "" {
+			continue
+		}
+		if !repo.upstreamGone(ctx, wt.Branch) {
+			continue
+		}
+
+		dirty, err := repo.hasChanges(ctx, wt.Path)
+		if err != nil {
+			return removed, err
+		}
+		if dirty {
+			wm.config.warnf("skipping %s: upstream %s is gone but the worktree has changes", wt.Path, upstream)
+			continue
+		}
+
+		fmt.Fprintf(os.Stderr, "upstream %s of %s is gone, remove worktree? [y/N] ", upstream, wt.Path)
+		answer, _ := reader.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			continue
+		}
+
+		if err := repo.removeWorktree(ctx, wt.Path, false); err != nil {
+			return removed, err
+		}
+		wm.config.statusf(Green, "removed worktree %s", wt.Path)
+		removed++
+	}
+
+	return removed, nil
+}
+
+// pruneWorktrees runs git worktree prune and returns the administrative
+// entries that were removed.
+func (r *GitRepo) pruneWorktrees(ctx context.Context) ([]string, error) {
+	var output bytes.Buffer
+	cmd := r.config.tracer.commandContext(ctx, "git", "worktree", "prune", "--verbose")
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("failed to prune worktrees: %w: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	var pruned []string
+	for _, line := range strings.Split(output.String(), "\n") {
+		if entry, ok := strings.CutPrefix(line, "Removing "); ok {
+			pruned = append(pruned, entry)
+		}
+	}
+	return pruned, nil
+}
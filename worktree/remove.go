@@ -0,0 +1,89 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrWorktreeNotFound = errors.New("worktree not found")
+	ErrWorktreeDirty    = errors.New("worktree has uncommitted or untracked changes, use -f to remove anyway")
+	ErrMainWorktree     = errors.New("refusing to remove the main worktree")
+)
+
+func (wm *WorktreeManager) RemoveWorktree(ctx context.Context, branchname string) error {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return err
+	}
+	wm.repo = repo
+
+	worktrees, err := repo.listWorktrees(ctx)
+	if err != nil {
+		return err
+	}
+
+	index, err := repo.findWorktree(worktrees, branchname)
+	if err != nil {
+		return err
+	}
+	if index == 0 {
+		return ErrMainWorktree
+	}
+	target := worktrees[index]
+
+	if !wm.config.Force {
+		dirty, err := repo.hasChanges(ctx, target.Path)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("%w: %s", ErrWorktreeDirty, target.Path)
+		}
+	}
+
+	if err := repo.removeWorktree(ctx, target.Path, wm.config.Force); err != nil {
+		return err
+	}
+	wm.config.statusf(Green, "removed worktree %s", target.Path)
+
+	if wm.config.DeleteBranch && target.Branch != "" {
+		if err := repo.deleteBranch(ctx, target.Branch, wm.config.Force); err != nil {
+			return err
+		}
+		wm.config.statusf(Green, "deleted branch %s", target.Branch)
+	}
+
+	return nil
+}
+
+func (r *GitRepo) removeWorktree(ctx context.Context, worktreePath string, force bool) error {
+	args := []string{"worktree", "remove"}
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, worktreePath)
+
+	cmd := r.config.tracer.commandContext(ctx, "git", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to remove worktree %s: %w", worktreePath, err)
+	}
+	return nil
+}
+
+func (r *GitRepo) deleteBranch(ctx context.Context, branchname string, force bool) error {
+	flag := "-d"
+	if force {
+		flag = "-D"
+	}
+
+	cmd := r.config.tracer.commandContext(ctx, "git", "branch", flag, branchname)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to delete branch %s: %w", branchname, err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Where the value of a setting comes from
+const (
+	sourceDefault    = "default"
+	sourceGitConfig  = "git config"
+	sourceFile       = "config file"
+	sourceEnv        = "env"
+	sourceFlag       = "flag"
+	sourceAttributes = ".gitattributes"
+)
+
+// setting is a resolved setting as ShowConfig prints it.
+type setting struct {
+	name   string
+	value  string
+	source string
+}
+
+// ShowConfig prints the settings that creating a worktree from the current
+// directory would use, each with where its value comes from. They are
+// resolved by the same code that creates worktrees, so that invalid values
+// are warned about and replaced by their defaults here too.
+func (wm *WorktreeManager) ShowConfig() error {
+	repo, err := wm.initGitRepo()
+	if err != nil {
+		return err
+	}
+	wm.repo = repo
+
+	c := wm.config
+	fc := &FileCopier{config: c}
+	var settings []setting
+	add := func(name, value, source string) {
+		if value == "" {
+			value = "(none)"
+		}
+		settings = append(settings, setting{name: name, value: value, source: source})
+	}
+	addKey := func(key, value string) {
+		add(key, value, c.configSource(key))
+	}
+	addValues := func(key string, values []string) {
+		addKey(key, strings.Join(values, ", "))
+	}
+
+	source := sourceDefault
+	if c.ConfigFile != "" {
+		source = sourceFlag
+	}
+	add("config file", c.configFilePath(), source)
+
+	baseDir, err := repo.worktreeBaseDir()
+	if err != nil {
+		return err
+	}
+	if os.Getenv("WORKTREE_BASEDIR") != "" {
+		add("worktree.basedir", baseDir, sourceEnv)
+	} else {
+		addKey("worktree.basedir", baseDir)
+	}
+	dirTemplate := c.configValue("worktree.dirtemplate")
+	if dirTemplate == "" {
+		dirTemplate = "{branch_safe}"
+	}
+	addKey("worktree.dirtemplate", dirTemplate)
+	addKey("worktree.remote", repo.remote)
+	defaultBranch, err := repo.defaultBranch()
+	if err != nil {
+		defaultBranch = "(unknown)"
+	}
+	addKey("worktree.basebranch", defaultBranch)
+	if c.NoPrefix {
+		add("worktree.branchprefix", "", sourceFlag)
+	} else {
+		addKey("worktree.branchprefix", c.configValue("worktree.branchprefix"))
+	}
+
+	switch {
+	case c.NoCopy:
+		add("worktree.untrackedfiles", "", sourceFlag)
+	case c.CopyPatterns != nil:
+		add("worktree.untrackedfiles", strings.Join(fc.getUntrackedFilesPatterns(""), ", "), sourceFlag)
+	default:
+		addValues("worktree.untrackedfiles", fc.configuredPatterns(""))
+	}
+	if !c.NoCopy && c.CopyPatterns == nil {
+		add(copyAttribute+" attribute", strings.Join(fc.attributePatterns(), ", "), sourceAttributes)
+	}
+	addValues("worktree.copymap", c.configValues("worktree.copymap"))
+	addValues("worktree.excludedirs", fc.getExcludedDirs())
+	addKey("worktree.includesubmodules", strconv.FormatBool(c.configBool("worktree.includesubmodules")))
+	if c.Link {
+		add("worktree.linkfiles", "true", sourceFlag)
+	} else {
+		addKey("worktree.linkfiles", strconv.FormatBool(c.configBool("worktree.linkfiles")))
+	}
+	addKey("worktree.copyconcurrency", strconv.Itoa(fc.copyConcurrency()))
+	fd := fc.fdCommand()
+	if fd == "" {
+		fd = "(none, walking the directory tree)"
+	}
+	addKey("worktree.fdpath", fd)
+
+	addValues("worktree.postcreate", c.configValues("worktree.postcreate"))
+	switch {
+	case c.configValue("worktree.editor") != "":
+		addKey("worktree.editor", c.configValue("worktree.editor"))
+	case os.Getenv("VISUAL") != "":
+		add("worktree.editor", os.Getenv("VISUAL"), sourceEnv)
+	case os.Getenv("EDITOR") != "":
+		add("worktree.editor", os.Getenv("EDITOR"), sourceEnv)
+	default:
+		addKey("worktree.editor", "")
+	}
+	tmuxCommand := c.configValue("worktree.tmuxcmd")
+	if tmuxCommand == "" {
+		tmuxCommand = defaultTmuxCommand
+	}
+	addKey("worktree.tmuxcmd", tmuxCommand)
+
+	if c.PullTimeout > 0 {
+		add("worktree.pulltimeout", c.PullTimeout.String(), sourceFlag)
+	} else {
+		addKey("worktree.pulltimeout", wm.pullTimeout().String())
+	}
+	addKey("worktree.pullretries", strconv.Itoa(wm.pullRetries()))
+	addKey("worktree.nativeadd", strconv.FormatBool(c.configBool("worktree.nativeadd")))
+	addKey("worktree.sshkey", c.configValue("worktree.sshkey"))
+	addKey("worktree.cabundle", c.configValue("worktree.cabundle"))
+	gitConfigKeys := c.configValues("worktree.gitconfigkeys")
+	if len(gitConfigKeys) == 0 {
+		gitConfigKeys = defaultGitConfigKeys
+	}
+	addValues("worktree.gitconfigkeys", gitConfigKeys)
+	addKey("worktree.hooksdir", c.configValue("worktree.hooksdir"))
+	addKey("worktree.branchfromurl", c.configValue("worktree.branchfromurl"))
+
+	nameWidth, sourceWidth := 0, 0
+	for _, s := range settings {
+		nameWidth = max(nameWidth, len(s.name))
+		sourceWidth = max(sourceWidth, len(s.source))
+	}
+	for _, s := range settings {
+		fmt.Printf("%-*s  %-*s  %s\n", nameWidth, s.name, sourceWidth, s.source, s.value)
+	}
+	return nil
+}
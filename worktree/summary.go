@@ -0,0 +1,80 @@
+package worktree
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// baseName returns what the worktree of branchname was created from, for
+// the summary: the pull request, the remote branch, the base ref from, or
+// HEAD. It is empty for an existing branch that was checked out as is.
+func (wm *WorktreeManager) baseName(repo *GitRepo, branchname string, created bool, from string, detach bool) string {
+	switch {
+	case wm.config.PR > 0:
+		return "pull request #" + strconv.Itoa(wm.config.PR)
+	case !created && !detach && !wm.config.Reset:
+		return ""
+	case !detach && !wm.config.ForceNewBranch && repo.branchExistsOnRemote(branchname):
+		return plumbing.NewRemoteReferenceName(repo.remote, branchname).Short()
+	case from != "":
+		return plumbing.ReferenceName(from).Short()
+	default:
+		return "HEAD"
+	}
+}
+
+// nodeModulesStatus returns whether a node_modules directory is among the
+// copied files, and how it was copied.
+func nodeModulesStatus(copied []string, hardlinked bool) string {
+	for _, file := range copied {
+		if inNodeModules(file) {
+			if hardlinked {
+				return "hardlinked"
+			}
+			return "copied"
+		}
+	}
+	return "not copied"
+}
+
+// printSummary prints result as a block of plain text after a new worktree is
+// set up, unless the output is quiet or JSON.
+func (wm *WorktreeManager) printSummary(result *CreateResult, elapsed time.Duration) {
+	if wm.config.Quiet || wm.config.JSON {
+		return
+	}
+
+	branch := result.Branch
+	if branch == "" {
+		branch = "(detached)"
+	}
+	base := result.Base
+	if base == "" {
+		base = "(existing branch)"
+	}
+	copied := fmt.Sprintf("%d files", len(result.Copied))
+	if len(result.Copied) == 1 {
+		copied = "1 file"
+	}
+	rows := [][2]string{
+		{"branch", branch},
+		{"path", result.Path},
+		{"base", base},
+		{"copied", copied},
+		{"node_modules", result.NodeModules},
+		{"direnv", result.Direnv},
+		{"took", elapsed.Round(time.Millisecond).String()},
+	}
+
+	out := os.Stdout
+	if wm.config.machineOutput() {
+		out = os.Stderr
+	}
+	for _, row := range rows {
+		fmt.Fprintf(out, "  %-12s  %s\n", row[0], row[1])
+	}
+}
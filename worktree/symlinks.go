@@ -0,0 +1,102 @@
+package worktree
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// symlinkTargets returns the files in the repository that the symlink rel
+// leads to, following chains such as .env -> .env.dev -> .env.dev.local, so
+// they are copied along with the link. The chain ends at a file that is no
+// symlink or at a link leaving the repository.
+func symlinkTargets(root, rel string) []string {
+	var targets []string
+	seen := map[string]bool{rel: true}
+	for path := rel; ; {
+		next, ok := resolveLink(root, path)
+		if !ok || seen[next] {
+			return targets
+		}
+		seen[next] = true
+		targets = append(targets, next)
+		path = next
+	}
+}
+
+// resolveLink returns the path relative to root that the symlink rel points
+// to, and false if rel is no symlink or points outside root.
+func resolveLink(root, rel string) (string, bool) {
+	link, ok := readLink(root, rel)
+	if !ok {
+		return "", false
+	}
+	return withinRoot(root, link)
+}
+
+// readLink returns the absolute path the symlink rel below root points to,
+// and false if rel is no symlink.
+func readLink(root, rel string) (string, bool) {
+	src := filepath.Join(root, rel)
+	info, err := os.Lstat(src)
+	if err != nil || info.Mode()&os.ModeSymlink == 0 {
+		return "", false
+	}
+	link, err := os.Readlink(src)
+	if err != nil {
+		return "", false
+	}
+	if !filepath.IsAbs(link) {
+		link = filepath.Join(filepath.Dir(src), link)
+	}
+	return filepath.Clean(link), true
+}
+
+// withinRoot returns path relative to root, and false if it lies outside.
+func withinRoot(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// worktreeLink returns what the copy of the symlink rel in a worktree points
+// to, and false if rel is no symlink. A link into the repository becomes
+// relative, so that it points to the copied target in the worktree, and a
+// link out of the repository becomes absolute, so that it still resolves from
+// the worktree.
+func worktreeLink(root, rel string) (string, bool) {
+	link, ok := readLink(root, rel)
+	if !ok {
+		return "", false
+	}
+	if _, inside := withinRoot(root, link); !inside {
+		return link, true
+	}
+	relLink, err := filepath.Rel(filepath.Dir(filepath.Join(root, rel)), link)
+	if err != nil {
+		return link, true
+	}
+	return relLink, true
+}
+
+// copySymlink creates the symlink dest pointing to link. An existing dest is
+// only replaced with overwrite.
+func copySymlink(link, dest string, overwrite bool) error {
+	if _, err := os.Lstat(dest); err == nil {
+		if existing, err := os.Readlink(dest); err == nil && existing == link && !overwrite {
+			return errDestUnchanged
+		}
+		if !overwrite {
+			return errDestExists
+		}
+		if err := os.Remove(dest); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(link, dest)
+}
@@ -0,0 +1,152 @@
+package worktree
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// newSymlinkTree returns a repository root with symlinks to relative and
+// absolute targets inside and outside of it, and the file outside it.
+func newSymlinkTree(t *testing.T) (string, string) {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(dir, "repo")
+	outside := filepath.Join(dir, "outside.env")
+	writeFiles(t, dir, "outside.env", filepath.Join("repo", ".env.dev.local"), filepath.Join("repo", "plain.env"))
+
+	links := map[string]string{
+		".env":          ".env.dev",
+		".env.dev":      ".env.dev.local",
+		"config/.env":   "../.env.dev.local",
+		"absolute.env":  filepath.Join(root, ".env.dev"),
+		"outside.env":   outside,
+		"relative.env":  "../outside.env",
+		"loop.a":        "loop.b",
+		"loop.b":        "loop.a",
+		"missing.env":   ".env.missing",
+		"config/up.env": "../../outside.env",
+	}
+	for link, target := range links {
+		path := filepath.Join(root, link)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(target, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, outside
+}
+
+func TestSymlinkTargets(t *testing.T) {
+	root, _ := newSymlinkTree(t)
+
+	tests := []struct {
+		rel  string
+		want []string
+	}{
+		{rel: ".env", want: []string{".env.dev", ".env.dev.local"}},
+		{rel: ".env.dev", want: []string{".env.dev.local"}},
+		{rel: "config/.env", want: []string{".env.dev.local"}},
+		{rel: "absolute.env", want: []string{".env.dev", ".env.dev.local"}},
+		{rel: "outside.env"},
+		{rel: "relative.env"},
+		{rel: "config/up.env"},
+		{rel: "loop.a", want: []string{"loop.b"}},
+		{rel: "missing.env", want: []string{".env.missing"}},
+		{rel: "plain.env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if got := symlinkTargets(root, tt.rel); !slices.Equal(got, tt.want) {
+				t.Errorf("symlinkTargets(%q) = %q, want %q", tt.rel, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWorktreeLink(t *testing.T) {
+	root, outside := newSymlinkTree(t)
+
+	tests := []struct {
+		rel    string
+		want   string
+		wantOK bool
+	}{
+		{rel: ".env", want: ".env.dev", wantOK: true},
+		{rel: "config/.env", want: filepath.Join("..", ".env.dev.local"), wantOK: true},
+		// Absolute into the repository becomes relative, to the copy
+		{rel: "absolute.env", want: ".env.dev", wantOK: true},
+		// Out of the repository becomes absolute, to the original
+		{rel: "outside.env", want: outside, wantOK: true},
+		{rel: "relative.env", want: outside, wantOK: true},
+		{rel: "config/up.env", want: outside, wantOK: true},
+		{rel: "plain.env"},
+		{rel: "nonexistent.env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			got, ok := worktreeLink(root, tt.rel)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("worktreeLink(%q) = %q, %v, want %q, %v", tt.rel, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestCopySymlink(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is what dest links to before, a regular file if "file"
+		// and nothing if empty
+		existing  string
+		overwrite bool
+		wantErr   error
+		want      string
+	}{
+		{name: "new", want: ".env.dev"},
+		{name: "same link", existing: ".env.dev", wantErr: errDestUnchanged, want: ".env.dev"},
+		{name: "other link", existing: ".env.prod", wantErr: errDestExists, want: ".env.prod"},
+		{name: "other link overwritten", existing: ".env.prod", overwrite: true, want: ".env.dev"},
+		{name: "same link overwritten", existing: ".env.dev", overwrite: true, want: ".env.dev"},
+		{name: "file", existing: "file", wantErr: errDestExists},
+		{name: "file overwritten", existing: "file", overwrite: true, want: ".env.dev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := filepath.Join(t.TempDir(), "config", ".env")
+			switch tt.existing {
+			case "":
+			case "file":
+				writeFiles(t, filepath.Dir(filepath.Dir(dest)), filepath.Join("config", ".env"))
+			default:
+				if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Symlink(tt.existing, dest); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := copySymlink(".env.dev", dest, tt.overwrite); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("copySymlink = %v, want %v", err, tt.wantErr)
+			}
+			link, err := os.Readlink(dest)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("dest is a symlink to %s, want the file kept", link)
+				}
+				return
+			}
+			if link != tt.want {
+				t.Errorf("dest links to %q, %v, want %q", link, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package worktree
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultTmuxCommand opens the worktree in a new window named after the
+// branch.
+const defaultTmuxCommand = `tmux new-window -c "$WORKTREE_PATH" -n "$WORKTREE_BRANCH"`
+
+// openTmuxWindow runs worktree.tmuxcmd, or defaultTmuxCommand, with the
+// environment of the post-create hooks. Outside of a tmux session it warns
+// and does nothing.
+func (wm *WorktreeManager) openTmuxWindow(ctx context.Context, branchname, worktreePath string) error {
+	if os.Getenv("TMUX") == "" {
+		wm.config.warnf("Not inside a tmux session, not opening a window for %s", worktreePath)
+		return nil
+	}
+
+	tmuxCommand := wm.config.configValue("worktree.tmuxcmd")
+	if tmuxCommand == "" {
+		tmuxCommand = defaultTmuxCommand
+	}
+	if wm.config.DryRun {
+		wm.config.dryRunf("run %q for %s", tmuxCommand, worktreePath)
+		return nil
+	}
+
+	absPath, err := filepath.Abs(worktreePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve worktree path: %w", err)
+	}
+	cmd := wm.tracer.shellCommand(ctx, tmuxCommand)
+	cmd.Dir = absPath
+	cmd.Env = hookEnv(branchname, absPath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%q: %v: %s", tmuxCommand, err, out)
+		}
+		return fmt.Errorf("%q: %v", tmuxCommand, err)
+	}
+	return nil
+}
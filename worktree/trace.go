@@ -0,0 +1,139 @@
+package worktree
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// secretArg matches arguments that carry a secret as key=value
+var secretArg = regexp.MustCompile(`(?i)^([^=]*(token|password|secret|authorization|extraheader)[^=]*=).+`)
+
+// urlPassword matches the password of a URL that doesn't parse
+var urlPassword = regexp.MustCompile(`(://[^/:@]*:)[^/@]*@`)
+
+// tracer logs the commands that are run when Config.Trace is set, and their
+// exit code and duration once they finish. A nil tracer logs nothing.
+type tracer struct {
+	logger *log.Logger
+}
+
+// tracedCmd is an exec.Cmd that reports to its tracer when it finishes.
+type tracedCmd struct {
+	*exec.Cmd
+	tracer *tracer
+	// line is the command line as traced, with secrets redacted
+	line  string
+	start time.Time
+}
+
+// command returns exec.Command(name, args...) after tracing it.
+func (t *tracer) command(name string, args ...string) *tracedCmd {
+	return t.trace(exec.Command(name, args...))
+}
+
+// commandContext returns exec.CommandContext(ctx, name, args...) after tracing
+// it. Once ctx is done, it doesn't wait long for the output of children that
+// outlive the command, such as git hooks.
+func (t *tracer) commandContext(ctx context.Context, name string, args ...string) *tracedCmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.WaitDelay = time.Second
+	return t.trace(cmd)
+}
+
+// shellCommand returns a command that runs command with the shell.
+func (t *tracer) shellCommand(ctx context.Context, command string) *tracedCmd {
+	if runtime.GOOS == "windows" {
+		return t.commandContext(ctx, "cmd", "/C", command)
+	}
+	return t.commandContext(ctx, "sh", "-c", command)
+}
+
+func (t *tracer) trace(cmd *exec.Cmd) *tracedCmd {
+	traced := &tracedCmd{Cmd: cmd, tracer: t}
+	if t == nil {
+		return traced
+	}
+	args := make([]string, len(cmd.Args))
+	for i, arg := range cmd.Args {
+		args[i] = redact(arg)
+	}
+	traced.line = strings.Join(args, " ")
+	t.logger.Printf("+ %s", traced.line)
+	return traced
+}
+
+func (c *tracedCmd) Start() error {
+	c.start = time.Now()
+	err := c.Cmd.Start()
+	if err != nil {
+		c.finished(err)
+	}
+	return err
+}
+
+func (c *tracedCmd) Wait() error {
+	err := c.Cmd.Wait()
+	c.finished(err)
+	return err
+}
+
+func (c *tracedCmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+func (c *tracedCmd) Output() ([]byte, error) {
+	c.start = time.Now()
+	output, err := c.Cmd.Output()
+	c.finished(err)
+	return output, err
+}
+
+func (c *tracedCmd) CombinedOutput() ([]byte, error) {
+	c.start = time.Now()
+	output, err := c.Cmd.CombinedOutput()
+	c.finished(err)
+	return output, err
+}
+
+// finished logs the exit code and duration of the command, or why it didn't
+// run.
+func (c *tracedCmd) finished(err error) {
+	if c.tracer == nil {
+		return
+	}
+	took := time.Since(c.start).Round(time.Millisecond)
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		c.tracer.logger.Printf("- exit 0 after %s: %s", took, c.line)
+	case errors.As(err, &exitErr):
+		c.tracer.logger.Printf("- exit %d after %s: %s", exitErr.ExitCode(), took, c.line)
+	default:
+		c.tracer.logger.Printf("- %v after %s: %s", err, took, c.line)
+	}
+}
+
+// redact hides the password of a URL and the value of key=value arguments that
+// look like secrets.
+func redact(arg string) string {
+	if strings.Contains(arg, "://") {
+		if u, err := url.Parse(arg); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "xxxxx")
+				return u.String()
+			}
+		}
+	}
+	arg = urlPassword.ReplaceAllString(arg, "${1}xxxxx@")
+	return secretArg.ReplaceAllString(arg, "${1}xxxxx")
+}
@@ -0,0 +1,64 @@
+package worktree
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// httpOptions returns the CA bundle and proxy to use for an HTTP(S) remote.
+// The CA bundle is read from the PEM file in worktree.cabundle and is trusted
+// together with the system roots. The proxy is taken from HTTPS_PROXY,
+// HTTP_PROXY, and NO_PROXY. Both are empty for other remotes or when unset.
+func (r *GitRepo) httpOptions() ([]byte, transport.ProxyOptions, error) {
+	remoteURL, err := r.remoteURL()
+	if err != nil {
+		return nil, transport.ProxyOptions{}, err
+	}
+	if !strings.HasPrefix(remoteURL, "https://") && !strings.HasPrefix(remoteURL, "http://") {
+		return nil, transport.ProxyOptions{}, nil
+	}
+
+	var caBundle []byte
+	if path := r.config.configValue("worktree.cabundle"); path != "" {
+		caBundle, err = os.ReadFile(expandHome(path))
+		if err != nil {
+			return nil, transport.ProxyOptions{}, fmt.Errorf("failed to read worktree.cabundle: %w", err)
+		}
+	}
+
+	proxy, err := proxyFor(remoteURL)
+	if err != nil {
+		return nil, transport.ProxyOptions{}, err
+	}
+	return caBundle, proxy, nil
+}
+
+// proxyFor returns the proxy from the environment for remoteURL, or no proxy
+// if none is set or NO_PROXY matches the host. Unlike net/http, it reads the
+// environment on every call instead of once.
+func proxyFor(remoteURL string) (transport.ProxyOptions, error) {
+	parsed, err := url.Parse(remoteURL)
+	if err != nil {
+		return transport.ProxyOptions{}, fmt.Errorf("failed to parse remote URL: %w", err)
+	}
+
+	proxyURL, err := httpproxy.FromEnvironment().ProxyFunc()(parsed)
+	if err != nil {
+		return transport.ProxyOptions{}, fmt.Errorf("invalid proxy: %w", err)
+	}
+	if proxyURL == nil {
+		return transport.ProxyOptions{}, nil
+	}
+
+	options := transport.ProxyOptions{URL: proxyURL.Scheme + "://" + proxyURL.Host}
+	if proxyURL.User != nil {
+		options.Username = proxyURL.User.Username()
+		options.Password, _ = proxyURL.User.Password()
+	}
+	return options, nil
+}